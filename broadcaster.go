@@ -3,24 +3,270 @@ package gotelem
 import (
 	"fmt"
 	"os"
+	"sort"
+	"sync"
+	"time"
 )
 
-type receiver interface {
-	receiverChannel() chan<- *Observation
+// The broadcaster passes observations on to the attached receivers.
+// Receivers can be added while observations are being broadcast. It
+// also remembers the names of the series it has broadcast, so that
+// they can be removed from the receivers when the instrument is
+// unregistered. The types of the series, see setSeriesType, are
+// remembered as well so that receivers added later are told about
+// them, and so is what the series are, see SeriesInfo.
+type broadcaster struct {
+	mu        sync.RWMutex
+	receivers []Receiver
+	series    map[string]bool
+	types     map[string]string
+
+	instrument  string
+	interval    time.Duration
+	description string
+	unit        string
+	// The series published under the instrument's own names, see
+	// declareSeries. Keyed by name, without labels.
+	declared map[string]*declaredSeries
+}
+
+type declaredSeries struct {
+	info SeriesInfo
+	unit seriesUnit
+}
+
+// Creates the broadcaster of the named instrument created by f.
+func newBroadcaster(instrument string, f *Factory) *broadcaster {
+	return &broadcaster{instrument: instrument, interval: f.SamplingInterval}
+}
+
+// Implemented by receivers which need to know what kind of series
+// they are given, like the HTTPPublisher which exposes counters as
+// Prometheus counters rather than gauges.
+type typedReceiver interface {
+	setSeriesType(name, typ string)
 }
 
-type broadcaster []chan<- *Observation
+// Implemented by receivers which keep series around, like the
+// HTTPPublisher, so that the series of an unregistered instrument can
+// be removed.
+type SeriesRemover interface {
+	RemoveSeries(names ...string)
+}
 
-func (b *broadcaster) AddReceiver(r receiver) {
-	if c := r.receiverChannel(); c != nil {
-		*b = append(*b, c)
+// Attaches a Receiver to the instrument. Every observation the
+// instrument produces from now on, including summaries, is passed to
+// the receiver.
+func (b *broadcaster) AddReceiver(r Receiver) {
+	if r != nil {
+		b.mu.Lock()
+		b.receivers = append(b.receivers, r)
+		types := make(map[string]string, len(b.types))
+		for name, typ := range b.types {
+			types[name] = typ
+		}
+		infos := b.seriesInfos()
+		b.mu.Unlock()
+		if t, ok := r.(typedReceiver); ok {
+			for name, typ := range types {
+				t.setSeriesType(name, typ)
+			}
+		}
+		if d, ok := r.(SeriesDescriber); ok {
+			for key, info := range infos {
+				d.DescribeSeries(key, info)
+			}
+		}
 	} else {
-		fmt.Fprintln(os.Stderr, "WARN: nil value from receiverChannel() from", r)
+		fmt.Fprintln(os.Stderr, "WARN: AddReceiver called with nil Receiver")
+	}
+}
+
+// Returns the keys of the series broadcast so far, sorted. See
+// Observation.Key.
+func (b *broadcaster) Series() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	names := make([]string, 0, len(b.series))
+	for name := range b.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (b *broadcaster) broadcast(o *Observation) {
+	b.mu.RLock()
+	receivers := b.receivers
+	key := o.Key()
+	seen := b.series[key]
+	b.mu.RUnlock()
+	if !seen {
+		b.mu.Lock()
+		if b.series == nil {
+			b.series = make(map[string]bool)
+		}
+		b.series[key] = true
+		info := b.seriesInfo(key)
+		b.mu.Unlock()
+		describeSeries(receivers, key, info)
+	}
+	for _, r := range receivers {
+		r.Receive(o)
+	}
+}
+
+// Sets the type of the named series, e.g. "counter", and tells the
+// receivers which care about it.
+func (b *broadcaster) setSeriesType(name, typ string) {
+	b.mu.Lock()
+	if b.types == nil {
+		b.types = make(map[string]string)
+	}
+	b.types[name] = typ
+	receivers := b.receivers
+	b.mu.Unlock()
+	for _, r := range receivers {
+		if t, ok := r.(typedReceiver); ok {
+			t.setSeriesType(name, typ)
+		}
+	}
+}
+
+// Sets the description of the instrument, e.g. "Time spent
+// scheduling", which is published along with its series.
+func (b *broadcaster) SetDescription(description string) {
+	b.mu.Lock()
+	b.description = description
+	b.mu.Unlock()
+	b.redescribe()
+}
+
+// Sets the unit of the values given to the instrument, e.g. "ms" or
+// "bytes", which is published along with its series.
+func (b *broadcaster) SetUnit(unit string) {
+	b.mu.Lock()
+	b.unit = unit
+	b.mu.Unlock()
+	b.redescribe()
+}
+
+// Returns what the series with the given key is, or nil if the
+// instrument has not broadcast it. See Observation.Key.
+func (b *broadcaster) SeriesInfo(key string) *SeriesInfo {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if !b.series[key] {
+		return nil
+	}
+	return b.seriesInfo(key)
+}
+
+// Declares the kind and unit of the series the instrument publishes
+// under the given name, e.g. the rate of a counter. The kind of other
+// series is RawSeries, or SummarySeries for the summaries, and their
+// unit that of the instrument. A zero interval declares that the
+// series is published as the values are observed rather than sampled.
+// The summaries of a declared series have its unit.
+func (b *broadcaster) declareSeries(name, kind string, interval time.Duration, unit seriesUnit) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.declared == nil {
+		b.declared = make(map[string]*declaredSeries)
+	}
+	b.declared[name] = &declaredSeries{SeriesInfo{Kind: kind, SamplingInterval: interval}, unit}
+}
+
+// Returns what the series with the given key is. Must be called with
+// mu held.
+func (b *broadcaster) seriesInfo(key string) *SeriesInfo {
+	name := parseSeriesName(key)
+	info := &SeriesInfo{Kind: RawSeries, SamplingInterval: b.interval}
+	unit := sameUnit
+	declared := b.declared[name.base]
+	if declared != nil {
+		unit = declared.unit
+	}
+	switch {
+	case name.statistic == "COUNT" || name.statistic == "BUCKET":
+		info.Kind, info.Statistic, info.Window = SummarySeries, name.statistic, name.window
+		unit = noUnit
+	case name.statistic != "":
+		info.Kind, info.Statistic, info.Window = SummarySeries, name.statistic, name.window
+	case declared != nil:
+		*info = declared.info
+	}
+	info.Instrument, info.Description, info.Unit = b.instrument, b.description, unit(b.unit)
+	return info
+}
+
+// Returns what each of the series broadcast so far is. Must be called
+// with mu held.
+func (b *broadcaster) seriesInfos() map[string]*SeriesInfo {
+	infos := make(map[string]*SeriesInfo, len(b.series))
+	for key := range b.series {
+		infos[key] = b.seriesInfo(key)
+	}
+	return infos
+}
+
+// Describes the series broadcast so far again to the receivers, after
+// the description or unit changed.
+func (b *broadcaster) redescribe() {
+	b.mu.RLock()
+	receivers := b.receivers
+	infos := b.seriesInfos()
+	b.mu.RUnlock()
+	for key, info := range infos {
+		describeSeries(receivers, key, info)
+	}
+}
+
+func describeSeries(receivers []Receiver, key string, info *SeriesInfo) {
+	for _, r := range receivers {
+		if d, ok := r.(SeriesDescriber); ok {
+			d.DescribeSeries(key, info)
+		}
+	}
+}
+
+// Removes the series broadcast so far, and the types of those of the
+// instrument, from the receivers that keep series.
+func (b *broadcaster) removeSeries() {
+	series := b.Series()
+	b.mu.RLock()
+	for name := range b.types {
+		if !b.series[name] {
+			series = append(series, name)
+		}
+	}
+	receivers := b.receivers
+	b.mu.RUnlock()
+	removeSeries(receivers, series)
+}
+
+// Forgets the series with exactly the given labels, those of a removed
+// labelled instrument, and removes them from the receivers that keep
+// series.
+func (b *broadcaster) removeLabelledSeries(labels Labels) {
+	suffix := labels.String()
+	var series []string
+	b.mu.Lock()
+	for key := range b.series {
+		if parseSeriesName(key).labels == suffix {
+			series = append(series, key)
+			delete(b.series, key)
+		}
 	}
+	receivers := b.receivers
+	b.mu.Unlock()
+	removeSeries(receivers, series)
 }
 
-func (b broadcaster) broadcast(o *Observation) {
-	for _, c := range b {
-		c <- o
+func removeSeries(receivers []Receiver, series []string) {
+	for _, r := range receivers {
+		if remover, ok := r.(SeriesRemover); ok {
+			remover.RemoveSeries(series...)
+		}
 	}
 }
@@ -1,6 +1,7 @@
 package gotelem
 
 import (
+	"sync"
 	"time"
 )
 
@@ -11,47 +12,74 @@ import (
 // like with a regular observer.
 type CallbackObserver struct {
 	*Sampler
-	broadcaster
+	*broadcaster
+	mu          sync.Mutex
+	summarizers map[string][]Summarizer
 }
 
 func NewCallbackObserver(callback func(time.Time) []*Observation, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (observer *CallbackObserver) {
-	observer = &CallbackObserver{}
-	if samplingInterval != 0 {
-		observer.Sampler = NewSampler(samplingInterval, observer.makeBackCaller(callback, summarizerWindows))
-	}
-	if httpPublisher != nil {
-		observer.AddReceiver(httpPublisher)
-	}
-	if logger != nil {
-		observer.AddReceiver(logger)
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewCallbackObserver(callback)
+}
+
+func newCallbackObserver(callback func(time.Time) []*Observation, f *Factory) (observer *CallbackObserver) {
+	observer = &CallbackObserver{
+		broadcaster: newBroadcaster("", f),
+		summarizers: make(map[string][]Summarizer)}
+	f.addReceivers(observer.broadcaster)
+	if f.SamplingInterval != 0 {
+		observer.Sampler = f.scheduler().NewSampler(f.SamplingInterval, observer.makeBackCaller(callback, f))
 	}
 	return
 }
 
-func (o *CallbackObserver) makeBackCaller(callback func(time.Time) []*Observation, summarizerWindows []time.Duration) func(t time.Time) {
+// Resets the summarizers of every series returned by the callback,
+// see Summarizer.Reset.
+func (o *CallbackObserver) ResetSummarizers() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, summers := range o.summarizers {
+		for _, summer := range summers {
+			summer.Reset()
+		}
+	}
+}
+
+func (o *CallbackObserver) makeBackCaller(callback func(time.Time) []*Observation, f *Factory) func(t time.Time) {
 	// TODO(go1.1)
 	// In Go 1.1 we apparently will be allowed to pass around methods
 	// just like we pass around funcs. Then we can move the state to
 	// the CallbackObserver itself and just pass this method to the
 	// Sampler. But until that, I'll just use a closure.
-	summarizers := make(map[string][]*SlidingWindowSummarizer)
 	return func(t time.Time) {
 		observations := callback(t)
 		for _, obs := range observations {
 			o.broadcast(obs)
-			summers, summersCreated := summarizers[obs.Name]
-			if !summersCreated {
-				for _, window := range summarizerWindows {
-					summers = append(summers, NewSlidingWindowSummarizer(obs.Name, window))
-				}
-				summarizers[obs.Name] = summers
-			}
-			for _, summer := range summers {
+			for _, summer := range o.summarizersFor(obs, f) {
 				summer.Update(obs)
-				for _, sum := range summer.Summarize() {
+				for _, sum := range setLabels(summer.Summarize(), obs.Labels) {
 					o.broadcast(sum)
 				}
 			}
 		}
 	}
 }
+
+// Returns the summarizers for the series of the observation, creating
+// them the first time the series is seen. Observations with the same
+// name but different labels are summarized separately.
+func (o *CallbackObserver) summarizersFor(obs *Observation, f *Factory) []Summarizer {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := obs.Key()
+	summers, summersCreated := o.summarizers[key]
+	if !summersCreated {
+		summers = f.makeSummarizers(obs.Name)
+		o.summarizers[key] = summers
+	}
+	return summers
+}
@@ -0,0 +1,146 @@
+package gotelem
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock is the source of time for the instruments, summarizers and
+// the scheduler. Everything uses the SystemClock unless a Factory is
+// given a different one, typically a ManualClock in tests.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer fires once on C after the duration it was created with,
+// like time.Timer.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// The Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	*time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// A ManualClock only moves when told to, which makes the whole
+// pipeline deterministic in tests:
+//
+//	clock := gotelem.NewManualClock(time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC))
+//	factory := &gotelem.Factory{Clock: clock, SamplingInterval: time.Second, ...}
+//	observer := factory.NewObserver("Test")
+//	clock.BlockUntil(1)        // waits for the scheduler to set its timer
+//	observer.Observe(42)
+//	clock.Advance(time.Second) // fires the sampling timer
+//	clock.BlockUntil(1)        // waits for the sampling to finish
+//
+// The scheduler sets a new timer once it has sampled everything, so
+// BlockUntil with the number of sampling intervals in use waits for a
+// sampling round to complete.
+type ManualClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	pending []*manualTimer
+}
+
+type manualTimer struct {
+	clock    *ManualClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func NewManualClock(now time.Time) *ManualClock {
+	c := &ManualClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+	} else {
+		c.pending = append(c.pending, t)
+		c.cond.Broadcast()
+	}
+	return t
+}
+
+// Moves the clock forward by d, firing the timers that expire.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	now := c.now.Add(d)
+	c.mu.Unlock()
+	c.Set(now)
+}
+
+// Sets the clock to t, firing the timers that expire.
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+	pending := c.pending[:0]
+	for _, timer := range c.pending {
+		if timer.deadline.After(t) {
+			pending = append(pending, timer)
+		} else {
+			timer.c <- t
+		}
+	}
+	c.pending = pending
+	c.cond.Broadcast()
+}
+
+// Blocks until at least n timers are waiting to fire.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.pending) < n {
+		c.cond.Wait()
+	}
+}
+
+func (t *manualTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.pending {
+		if p == t {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
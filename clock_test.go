@@ -0,0 +1,77 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualClockTimers(t *testing.T) {
+	start := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	early := clock.NewTimer(time.Second)
+	late := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Errorf("Stop should report a pending timer as stopped")
+	}
+	clock.Advance(time.Second)
+	select {
+	case fired := <-early.C():
+		if !fired.Equal(start.Add(time.Second)) {
+			t.Errorf("Expected timer to fire at %v, got %v", start.Add(time.Second), fired)
+		}
+	default:
+		t.Errorf("Expected timer to fire when the clock reaches its deadline")
+	}
+	select {
+	case <-late.C():
+		t.Errorf("Timer fired before its deadline")
+	case <-stopped.C():
+		t.Errorf("Stopped timer fired")
+	default:
+	}
+	clock.BlockUntil(1)
+	if !clock.Now().Equal(start.Add(time.Second)) {
+		t.Errorf("Expected clock at %v, got %v", start.Add(time.Second), clock.Now())
+	}
+}
+
+// With a manual clock the sampled series are fully determined by the
+// test.
+func TestFactoryClock(t *testing.T) {
+	start := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	clock := NewManualClock(start)
+	p := NewHTTPPublisher(100)
+	factory := &Factory{
+		SamplingInterval:  time.Second,
+		SummarizerWindows: []time.Duration{time.Minute},
+		HTTPPublisher:     p,
+		Clock:             clock}
+	counter := factory.NewCounter("Calls")
+	defer counter.Stop()
+	clock.BlockUntil(1)
+	for i := 1; i <= 3; i++ {
+		for j := 0; j < i; j++ {
+			counter.Inc()
+		}
+		clock.Advance(time.Second)
+		clock.BlockUntil(1)
+	}
+	p.Flush()
+
+	rates := p.values("Calls/sec")
+	if len(rates) != 3 {
+		t.Fatalf("Expected 3 samples, got %v", len(rates))
+	}
+	for i, o := range rates {
+		if !o.Timestamp.Equal(start.Add(time.Duration(i+1) * time.Second)) {
+			t.Errorf("Sample %v has timestamp %v", i, o.Timestamp)
+		}
+		if o.Value != float64(i+1) {
+			t.Errorf("Expected rate %v, got %v", i+1, o.Value)
+		}
+	}
+	if sums := p.values("Calls/sec:1M_SUM"); len(sums) != 3 || sums[2].Value != 6 {
+		t.Errorf("Expected a 1M_SUM of 6 after 3 samples, got %v", sums)
+	}
+}
@@ -1,95 +1,251 @@
 package gotelem
 
 import (
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// A Counter keeps a count which is safe to update from any number of
+// goroutines. Every time the counter is sampled it publishes the
+// current count as well as the rate at which it changed since the
+// previous sample, as name/sec for a rate per second. A
+// counter with labels, as returned by With, keeps a count of its own
+// which is sampled together with the counter it was made from.
+//
+// A monotonic counter, see SetMonotonic, only counts up, so only its
+// count is exposed as a Prometheus counter rather than a gauge. Reset
+// sets the count back to zero without the rate going negative, so the
+// rate series only ever counts what was added.
 type Counter struct {
-	name string
+	// Updated atomically by Add, Inc and Dec. Kept first in the struct
+	// so that it is 64-bit aligned on 32-bit platforms. The remaining
+	// state is only touched from the sampler goroutine.
+	count int64
+	// The sum of the counts at each Reset, guarded by resetMu along
+	// with the swapping of the count in Reset.
+	resets    int64
+	resetMu   sync.Mutex
+	monotonic int32
+	name      string
+	labels    Labels
 	*Sampler
-	broadcaster
-	countSummarizers []*SlidingWindowSummarizer
-	deltaSummarizers []*SlidingWindowSummarizer
+	*broadcaster
+	countSummarizers []Summarizer
+	rateSummarizers  []Summarizer
 	rateUnit         string
-	count            int64
-	prevSample       int64
+	rate             *rateTracker
+	prevTotal        int64
+	// The counter created by the factory, which keeps track of the
+	// labelled counters. For that counter root is itself.
+	root     *Counter
+	factory  *Factory
+	children labelledSet
 }
 
 func NewCounter(name string, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (counter *Counter) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewCounter(name)
+}
+
+func newCounter(name string, f *Factory) (counter *Counter) {
 	counter = &Counter{
-		name:     name,
-		rateUnit: rateUnit(samplingInterval)}
+		name:        name,
+		broadcaster: newBroadcaster(name, f),
+		rateUnit:    unitName(f.rateUnit()),
+		rate:        f.newRateTracker(),
+		factory:     f}
+	counter.root = counter
 	// TODO(go1.1)
 	// We'll need this until Go 1.1 allows us to pass methods around
 	// just like funcs
 	sample := func(t time.Time) {
 		counter.sample(t)
 	}
-	if httpPublisher != nil {
-		counter.AddReceiver(httpPublisher)
-	}
-	if logger != nil {
-		counter.AddReceiver(logger)
-	}
-	if samplingInterval != 0 {
-		counter.Sampler = NewSampler(samplingInterval, sample)
-		counter.countSummarizers, counter.deltaSummarizers = counter.makeSummarizers(summarizerWindows)
+	f.addReceivers(counter.broadcaster)
+	counter.declareSeries(name, CountSeries, f.SamplingInterval, sameUnit)
+	counter.declareSeries(name+"/"+counter.rateUnit, RateSeries, f.SamplingInterval, perUnit(counter.rateUnit))
+	if f.SamplingInterval != 0 {
+		counter.countSummarizers = f.makeSummarizers(name)
+		counter.rateSummarizers = f.makeSummarizers(name + "/" + counter.rateUnit)
+		counter.Sampler = f.scheduler().NewSampler(f.SamplingInterval, sample)
 	}
 	return
 }
 
+func (c *Counter) Name() string {
+	return c.name
+}
+
+// Returns the labels of the counter, nil for the counter created by
+// the factory.
+func (c *Counter) Labels() Labels {
+	return c.labels
+}
+
+// Returns the counter for the series with the given labels added to
+// those of c. The labels are given as alternating keys and values:
+//
+//	requests.With("route", "/x").Inc()
+//
+// The same labels always give the same counter. The labelled counter
+// shares the sampler and receivers of c, so stopping either stops
+// both.
+func (c *Counter) With(keysAndValues ...string) *Counter {
+	labels := c.labels.with(keysAndValues)
+	root := c.root
+	return root.children.get(labels, func() labelledInstrument {
+		child := &Counter{
+			monotonic:   atomic.LoadInt32(&root.monotonic),
+			name:        root.name,
+			labels:      labels,
+			Sampler:     root.Sampler,
+			broadcaster: root.broadcaster,
+			rateUnit:    root.rateUnit,
+			rate:        root.factory.newRateTracker(),
+			root:        root}
+		if root.factory.SamplingInterval != 0 {
+			child.countSummarizers = root.factory.makeSummarizers(root.name)
+			child.rateSummarizers = root.factory.makeSummarizers(root.name + "/" + root.rateUnit)
+		}
+		return child
+	}).(*Counter)
+}
+
+// Removes the counter with the given labels added to those of c, see
+// With and Observer.Remove.
+func (c *Counter) Remove(keysAndValues ...string) bool {
+	labels := c.labels.with(keysAndValues)
+	if !c.root.children.remove(labels) {
+		return false
+	}
+	c.removeLabelledSeries(labels)
+	return true
+}
+
 func (c *Counter) Inc() {
-	c.count = atomic.AddInt64(&c.count, 1)
+	c.Add(1)
 }
 
 func (c *Counter) Dec() {
-	c.count = atomic.AddInt64(&c.count, -1)
+	c.Add(-1)
 }
 
-func (c *Counter) makeSummarizers(windows []time.Duration) (countSummarizers, deltaSummarizers []*SlidingWindowSummarizer) {
-	countSummarizers = make([]*SlidingWindowSummarizer, len(windows))
-	deltaSummarizers = make([]*SlidingWindowSummarizer, len(windows))
-	for i, w := range windows {
-		countSummarizers[i] = NewSlidingWindowSummarizer(c.name, w)
-		deltaSummarizers[i] = NewSlidingWindowSummarizer(c.name+"/"+c.rateUnit, w)
+// Adds n, which may be negative, to the count. A monotonic counter
+// ignores negative n.
+func (c *Counter) Add(n int64) {
+	if n < 0 && atomic.LoadInt32(&c.monotonic) != 0 {
+		return
 	}
-	return
+	atomic.AddInt64(&c.count, n)
+}
+
+// Returns the current count.
+func (c *Counter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// Sets the count back to zero. The rate published at the next sample
+// is that of what was added since the previous sample, not of the drop
+// to zero.
+func (c *Counter) Reset() {
+	c.resetMu.Lock()
+	c.resets += atomic.SwapInt64(&c.count, 0)
+	c.resetMu.Unlock()
+}
+
+// Makes the counter ignore decrements, so that Dec and Add with a
+// negative n have no effect. Labelled counters made from the counter
+// afterwards are monotonic as well. The type of the series, see
+// Counter, follows that of the counter created by the factory.
+func (c *Counter) SetMonotonic(monotonic bool) {
+	var m int32
+	if monotonic {
+		m = 1
+	}
+	atomic.StoreInt32(&c.monotonic, m)
+	if c.root == c {
+		c.setSeriesType(c.name, countType(monotonic))
+	}
+}
+
+// Returns the count together with the total of the counts at each
+// Reset.
+func (c *Counter) sampleCount() (count, total int64) {
+	c.resetMu.Lock()
+	defer c.resetMu.Unlock()
+	count = atomic.LoadInt64(&c.count)
+	return count, count + c.resets
+}
+
+// Resets all the summarizers of the counter, see Summarizer.Reset.
+// The count itself is left as it is. Resetting the counter created by
+// the factory also resets the labelled counters made from it.
+func (c *Counter) ResetSummarizers() {
+	for _, s := range c.countSummarizers {
+		s.Reset()
+	}
+	for _, s := range c.rateSummarizers {
+		s.Reset()
+	}
+	c.children.each(func(child labelledInstrument) {
+		child.ResetSummarizers()
+	})
 }
 
 func (c *Counter) sample(t time.Time) {
-	sampledCount := c.count
-	delta := sampledCount - c.prevSample
-	c.prevSample = sampledCount
+	sampledCount, total := c.sampleCount()
+	delta := total - c.prevTotal
+	c.prevTotal = total
 
-	observation := &Observation{Timestamp: t, Name: c.name, Value: float64(sampledCount)}
-	deltaObservation := &Observation{Timestamp: t, Name: c.name + "/" + c.rateUnit, Value: float64(delta)}
+	rateName := c.name + "/" + c.rateUnit
+	observation := &Observation{Timestamp: t, Name: c.name, Value: float64(sampledCount), Labels: c.labels}
+	rateObservation := &Observation{Timestamp: t, Name: rateName, Value: c.rate.update(t, float64(delta)), Labels: c.labels}
 
 	//c.httpPublisher.Add(observation)
 	//c.logObservation(observation)
-	//c.httpPublisher.Add(deltaObservation)
-	//c.logObservation(deltaObservation)
+	//c.httpPublisher.Add(rateObservation)
+	//c.logObservation(rateObservation)
 	c.broadcast(observation)
-	c.broadcast(deltaObservation)
+	c.broadcast(rateObservation)
+	for _, obs := range c.rate.averageObservations(t, rateName, c.labels) {
+		c.broadcast(obs)
+	}
 	for _, s := range c.countSummarizers {
 		s.Update(observation)
-		for _, obs := range s.Summarize() {
+		for _, obs := range setLabels(s.Summarize(), c.labels) {
 			//c.httpPublisher.Add(obs)
 			//c.logObservation(obs)
 			c.broadcast(obs)
 		}
 	}
-	for _, s := range c.deltaSummarizers {
-		s.Update(deltaObservation)
-		for _, obs := range s.Summarize() {
+	for _, s := range c.rateSummarizers {
+		s.Update(rateObservation)
+		for _, obs := range setLabels(s.Summarize(), c.labels) {
 			//c.httpPublisher.Add(obs)
 			//c.logObservation(obs)
 			c.broadcast(obs)
 		}
 	}
+	c.children.sample(t)
+}
+
+// Returns the Prometheus type of the count of a counter, which is a
+// counter only if it never goes down.
+func countType(monotonic bool) string {
+	if monotonic {
+		return "counter"
+	}
+	return "gauge"
 }
 
-func rateUnit(interval time.Duration) (unit string) {
+// Returns the name of the unit of a rate or a duration, e.g. sec for a
+// rate per second or durations in seconds.
+func unitName(interval time.Duration) (unit string) {
 	switch interval {
 	case time.Nanosecond:
 		unit = "ns"
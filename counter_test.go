@@ -0,0 +1,43 @@
+package gotelem
+
+import "testing"
+
+func TestCounter(t *testing.T) {
+	tp := newTestPipeline()
+	c := tp.factory.NewCounter("Bytes")
+	defer c.Stop()
+	tp.start()
+
+	c.Add(1000)
+	c.Inc()
+	c.Dec()
+	c.Add(-100)
+	tp.sample()
+	if v := lastValue(t, tp.p, "Bytes"); v != 900 {
+		t.Errorf("Expected a count of 900, got %v", v)
+	}
+
+	c.Add(50)
+	c.Reset()
+	c.Add(20)
+	tp.sample()
+	if v := lastValue(t, tp.p, "Bytes"); v != 20 {
+		t.Errorf("Expected a count of 20 after Reset, got %v", v)
+	}
+	if v := lastValue(t, tp.p, "Bytes/sec"); v != 70 {
+		t.Errorf("Expected the rate to count what was added across the Reset, got %v", v)
+	}
+
+	c.SetMonotonic(true)
+	c.Dec()
+	c.Add(-5)
+	c.With("route", "/x").Add(-5)
+	c.With("route", "/x").Add(3)
+	tp.sample()
+	if v := lastValue(t, tp.p, "Bytes/sec"); v != 0 {
+		t.Errorf("Expected a monotonic counter to ignore decrements, got a rate of %v", v)
+	}
+	if v := lastValue(t, tp.p, `Bytes{route="/x"}`); v != 3 {
+		t.Errorf("Expected a labelled counter to be monotonic as well, got %v", v)
+	}
+}
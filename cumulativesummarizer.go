@@ -0,0 +1,75 @@
+package gotelem
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// The CumulativeSummarizer computes avg/sum/count/min/max over every
+// observation seen since it was created or last Reset. Unlike the
+// SlidingWindowSummarizer it doesn't keep the observations around,
+// just the running totals, so it uses the same small amount of memory
+// no matter how many observations it sees. The summaries are
+// published with the ALL suffix, e.g. name:ALL_AVG.
+type CumulativeSummarizer struct {
+	mu      sync.Mutex
+	name    string
+	sum     float64
+	count   int64
+	min     float64
+	max     float64
+	timeNow func() time.Time
+}
+
+func NewCumulativeSummarizer(name string) *CumulativeSummarizer {
+	s := &CumulativeSummarizer{name: name, timeNow: time.Now}
+	s.Reset()
+	return s
+}
+
+func (s *CumulativeSummarizer) Update(o *Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sum += o.Value
+	s.count++
+	if o.Value < s.min {
+		s.min = o.Value
+	}
+	if o.Value > s.max {
+		s.max = o.Value
+	}
+}
+
+func (s *CumulativeSummarizer) Summarize() []*Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.timeNow().UTC()
+	avg := math.NaN()
+	if s.count != 0 {
+		avg = s.sum / float64(s.count)
+	}
+	return []*Observation{
+		&Observation{Timestamp: now, Name: s.name + ":ALL_MIN", Value: s.min},
+		&Observation{Timestamp: now, Name: s.name + ":ALL_MAX", Value: s.max},
+		&Observation{Timestamp: now, Name: s.name + ":ALL_SUM", Value: s.sum},
+		&Observation{Timestamp: now, Name: s.name + ":ALL_AVG", Value: avg},
+		&Observation{Timestamp: now, Name: s.name + ":ALL_COUNT", Value: float64(s.count)}}
+}
+
+// Sets the clock giving the timestamps of the summaries.
+func (s *CumulativeSummarizer) setClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeNow = c.Now
+}
+
+// Starts the summary over as if no observations had been seen.
+func (s *CumulativeSummarizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sum = 0
+	s.count = 0
+	s.min = math.MaxFloat64
+	s.max = -math.MaxFloat64
+}
@@ -0,0 +1,64 @@
+package gotelem
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func summaryValues(summaries []*Observation) map[string]float64 {
+	values := make(map[string]float64)
+	for _, o := range summaries {
+		values[o.Name] = o.Value
+	}
+	return values
+}
+
+func TestCumulativeSummarizer(t *testing.T) {
+	s := NewCumulativeSummarizer("Test")
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		s.Update(&Observation{Timestamp: ts.Add(time.Duration(i) * time.Hour), Name: "Test", Value: float64(i)})
+	}
+	expected := map[string]float64{
+		"Test:ALL_MIN":   1,
+		"Test:ALL_MAX":   100,
+		"Test:ALL_SUM":   5050,
+		"Test:ALL_AVG":   50.5,
+		"Test:ALL_COUNT": 100}
+	values := summaryValues(s.Summarize())
+	for name, v := range expected {
+		if values[name] != v {
+			t.Errorf("Expected %v=%v, got %v", name, v, values[name])
+		}
+	}
+
+	s.Reset()
+	values = summaryValues(s.Summarize())
+	if values["Test:ALL_COUNT"] != 0 || values["Test:ALL_SUM"] != 0 {
+		t.Errorf("Expected count and sum to be 0 after Reset, got %v", values)
+	}
+	if !math.IsNaN(values["Test:ALL_AVG"]) {
+		t.Errorf("Expected AVG to be NaN after Reset, got %v", values["Test:ALL_AVG"])
+	}
+	s.Update(&Observation{Timestamp: ts, Name: "Test", Value: -3})
+	values = summaryValues(s.Summarize())
+	if values["Test:ALL_MIN"] != -3 || values["Test:ALL_MAX"] != -3 {
+		t.Errorf("Expected MIN=MAX=-3 after Reset and Update, got %v", values)
+	}
+}
+
+func TestFactoryCumulativeSummarizers(t *testing.T) {
+	factory := &Factory{
+		SamplingInterval:  time.Hour,
+		SummarizerWindows: []time.Duration{time.Minute},
+		Summarizers:       []SummarizerMaker{CumulativeSummarizers()}}
+	observer := factory.NewObserver("Test")
+	defer observer.Stop()
+	if len(observer.summarizers) != 2 {
+		t.Fatalf("Expected a sliding window and a cumulative summarizer, got %v", len(observer.summarizers))
+	}
+	if _, ok := observer.summarizers[1].(*CumulativeSummarizer); !ok {
+		t.Errorf("Expected the second summarizer to be cumulative, got %T", observer.summarizers[1])
+	}
+}
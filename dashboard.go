@@ -0,0 +1,22 @@
+package gotelem
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// The dashboard served on /dashboard. It only talks to the publisher
+// through relative URLs, so it works wherever the publisher is mounted.
+// For them to resolve, /dashboard/ is redirected to /dashboard.
+//
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+// Serves a dashboard which lists the available series and plots the
+// selected ones along with their summaries, refreshing the plots
+// every few seconds. The dashboard is a single page without any
+// dependencies, embedded in the binary.
+func (h *HTTPPublisher) RespondDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardHTML)
+}
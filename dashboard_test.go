@@ -0,0 +1,33 @@
+package gotelem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRespondDashboard(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/dashboard", nil))
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("Unexpected content type %v", contentType)
+	}
+	if !strings.Contains(w.Body.String(), `get("./series?"`) {
+		t.Errorf("Expected the dashboard to fetch the series relative to the publisher")
+	}
+}
+
+func TestDashboardTrailingSlash(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	stripped := http.NewServeMux()
+	stripped.Handle("/telemetry/", http.StripPrefix("/telemetry", p))
+	for prefix, handler := range map[string]http.Handler{"": p, "/telemetry": stripped} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", prefix+"/dashboard/?q=A", nil))
+		if location := w.Header().Get("Location"); w.Code != http.StatusMovedPermanently || location != prefix+"/dashboard?q=A" {
+			t.Errorf("Expected %v/dashboard/ to redirect to the dashboard, got %v %q", prefix, w.Code, location)
+		}
+	}
+}
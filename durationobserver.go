@@ -0,0 +1,93 @@
+package gotelem
+
+import (
+	"time"
+)
+
+// A DurationObserver is an Observer of durations, a timer. The
+// durations are observed in the unit of the observer, which is part of
+// the name of its series, so a duration observer named Latency with
+// the unit time.Millisecond publishes Latency_ms, Latency_ms:1M_AVG
+// and so on. The unit is also set as the unit of the series, see
+// SetUnit.
+//
+// Durations are measured with Time or with a Stopwatch:
+//
+//	defer latency.StartStopwatch().Stop()
+//
+// Start and Stop are those of the Sampler, as for other instruments.
+type DurationObserver struct {
+	*Observer
+	unit time.Duration
+}
+
+// A Stopwatch measures the time from DurationObserver.StartStopwatch
+// until Stop.
+type Stopwatch struct {
+	observer *DurationObserver
+	start    time.Time
+}
+
+// Creates a duration observer with the given unit, e.g.
+// time.Millisecond.
+func NewDurationObserver(name string, unit time.Duration, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (observer *DurationObserver) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewDurationObserver(name, unit)
+}
+
+func newDurationObserver(name string, unit time.Duration, f *Factory) *DurationObserver {
+	unit = durationUnit(unit)
+	observer := newObserver(name+"_"+unitName(unit), f)
+	observer.instrument = name
+	observer.SetUnit(unitName(unit))
+	return &DurationObserver{observer, unit}
+}
+
+// Returns the unit, or milliseconds if the unit is not positive.
+func durationUnit(unit time.Duration) time.Duration {
+	if unit <= 0 {
+		return time.Millisecond
+	}
+	return unit
+}
+
+// Returns the unit of the durations.
+func (d *DurationObserver) Unit() time.Duration {
+	return d.unit
+}
+
+// Observes the duration in the unit of the observer.
+func (d *DurationObserver) Observe(duration time.Duration) {
+	d.Observer.Observe(float64(duration) / float64(d.unit))
+}
+
+// Calls f and observes how long it took.
+func (d *DurationObserver) Time(f func()) {
+	defer d.StartStopwatch().Stop()
+	f()
+}
+
+// Starts a stopwatch which observes the time since it was started
+// when it is stopped.
+func (d *DurationObserver) StartStopwatch() *Stopwatch {
+	return &Stopwatch{d, d.timeNow()}
+}
+
+// Returns a duration observer for the series with the given labels,
+// see Observer.With. The duration observers returned for the same
+// labels share the labelled observer.
+func (d *DurationObserver) With(keysAndValues ...string) *DurationObserver {
+	return &DurationObserver{d.Observer.With(keysAndValues...), d.unit}
+}
+
+// Observes the time since the stopwatch was started and returns it.
+// A stopwatch can be stopped more than once, every stop is observed.
+func (s *Stopwatch) Stop() (elapsed time.Duration) {
+	elapsed = s.observer.timeNow().Sub(s.start)
+	s.observer.Observe(elapsed)
+	return
+}
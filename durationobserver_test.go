@@ -0,0 +1,44 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDurationObserver(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	clock := tp.clock
+	factory := tp.factory
+	factory.Registry = NewRegistry()
+	latency := factory.NewDurationObserver("Latency", time.Millisecond)
+	defer latency.Stop()
+	if factory.NewDurationObserver("Latency", time.Millisecond) != latency {
+		t.Errorf("Expected the registered duration observer to be returned")
+	}
+	tp.start()
+
+	stopwatch := latency.StartStopwatch()
+	clock.Advance(250 * time.Millisecond)
+	if elapsed := stopwatch.Stop(); elapsed != 250*time.Millisecond {
+		t.Errorf("Expected the stopwatch to measure 250ms, got %v", elapsed)
+	}
+	latency.Time(func() {
+		clock.Advance(500 * time.Millisecond)
+	})
+	latency.With("route", "/x").Observe(2 * time.Second)
+	clock.Advance(250 * time.Millisecond)
+	clock.BlockUntil(1)
+
+	tp.expect(t, map[string]float64{
+		"Latency_ms:1M_AVG":             375,
+		"Latency_ms:1M_COUNT":           2,
+		`Latency_ms{route="/x"}`:        2000,
+		`Latency_ms:1M_MAX{route="/x"}`: 2000,
+	})
+
+	seconds := factory.NewDurationObserver("Duration", time.Second)
+	defer seconds.Stop()
+	if seconds.Name() != "Duration_sec" {
+		t.Errorf("Expected the unit in the name, got %v", seconds.Name())
+	}
+}
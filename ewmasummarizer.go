@@ -0,0 +1,123 @@
+package gotelem
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// The EWMASummarizer publishes an exponentially weighted moving
+// average of the observations, a smoother alternative to the average
+// of a sliding window which does not need to keep the observations
+// around.
+//
+// The weight of an observation is either halved every half-life, which
+// handles observations arriving at irregular intervals, or multiplied
+// by 1-alpha for every new observation. The average is the weighted
+// average of all the observations so far, so the first observations
+// are not biased towards zero. With a half-life of one minute the
+// average is published as name:EWMA_1M, with an alpha of 0.1 as
+// name:EWMA_A0.1.
+type EWMASummarizer struct {
+	mu       sync.Mutex
+	name     string
+	halfLife time.Duration
+	alpha    float64
+	sum      float64
+	weight   float64
+	last     time.Time
+	timeNow  func() time.Time
+}
+
+// Returns a SummarizerMaker for EWMA summarizers with the given
+// half-life, for use in Factory.Summarizers.
+func EWMASummarizers(halfLife time.Duration) SummarizerMaker {
+	return func(name string) Summarizer {
+		return NewEWMASummarizer(name, halfLife)
+	}
+}
+
+// Returns a SummarizerMaker for EWMA summarizers with the given alpha,
+// for use in Factory.Summarizers.
+func EWMASummarizersWithAlpha(alpha float64) SummarizerMaker {
+	return func(name string) Summarizer {
+		return NewEWMASummarizerWithAlpha(name, alpha)
+	}
+}
+
+// Creates a summarizer where the weight of an observation is halved
+// every halfLife.
+func NewEWMASummarizer(name string, halfLife time.Duration) *EWMASummarizer {
+	if halfLife <= 0 {
+		panic("NewEWMASummarizer: halfLife must be positive")
+	}
+	return &EWMASummarizer{name: name, halfLife: halfLife, timeNow: time.Now}
+}
+
+// Creates a summarizer where the weight of the previous observations
+// is multiplied by 1-alpha for every new observation. Alpha must be
+// in (0, 1].
+func NewEWMASummarizerWithAlpha(name string, alpha float64) *EWMASummarizer {
+	if alpha <= 0 || alpha > 1 {
+		panic("NewEWMASummarizerWithAlpha: alpha must be in (0, 1]")
+	}
+	return &EWMASummarizer{name: name, alpha: alpha, timeNow: time.Now}
+}
+
+func (s *EWMASummarizer) Update(o *Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	decay := 1 - s.alpha
+	if s.halfLife > 0 {
+		// Observations older than the previous one are weighted as
+		// if they arrived at the same time.
+		decay = 1
+		if !s.last.IsZero() && o.Timestamp.After(s.last) {
+			decay = math.Exp2(-float64(o.Timestamp.Sub(s.last)) / float64(s.halfLife))
+		}
+		if o.Timestamp.After(s.last) {
+			s.last = o.Timestamp
+		}
+	}
+	s.sum = s.sum*decay + o.Value
+	s.weight = s.weight*decay + 1
+}
+
+// Returns the current average, NaN if there have been no observations.
+func (s *EWMASummarizer) Value() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.weight == 0 {
+		return math.NaN()
+	}
+	return s.sum / s.weight
+}
+
+func (s *EWMASummarizer) Summarize() []*Observation {
+	s.mu.Lock()
+	now := s.timeNow().UTC()
+	s.mu.Unlock()
+	return []*Observation{&Observation{Timestamp: now, Name: s.name + ":EWMA_" + s.suffix(), Value: s.Value()}}
+}
+
+func (s *EWMASummarizer) suffix() string {
+	if s.halfLife > 0 {
+		return suffix(s.halfLife)
+	}
+	return "A" + strconv.FormatFloat(s.alpha, 'f', -1, 64)
+}
+
+func (s *EWMASummarizer) setClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeNow = c.Now
+}
+
+func (s *EWMASummarizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sum = 0
+	s.weight = 0
+	s.last = time.Time{}
+}
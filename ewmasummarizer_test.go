@@ -0,0 +1,81 @@
+package gotelem
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEWMASummarizer(t *testing.T) {
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	s := NewEWMASummarizer("Test", time.Minute)
+	if !math.IsNaN(s.Value()) {
+		t.Errorf("Expected NaN without observations, got %v", s.Value())
+	}
+	s.Update(&Observation{Timestamp: ts, Name: "Test", Value: 10})
+	s.Update(&Observation{Timestamp: ts, Name: "Test", Value: 20})
+	if s.Value() != 15 {
+		t.Errorf("Expected simultaneous observations to be weighted equally, got %v", s.Value())
+	}
+	// After one half-life the earlier observations weigh half as much
+	// as the new one: (10+20)/2 + 40 over 1/2+1/2+1.
+	s.Update(&Observation{Timestamp: ts.Add(time.Minute), Name: "Test", Value: 40})
+	if v := s.Value(); math.Abs(v-27.5) > 1e-9 {
+		t.Errorf("Expected 27.5 after a half-life, got %v", v)
+	}
+	summaries := s.Summarize()
+	if len(summaries) != 1 || summaries[0].Name != "Test:EWMA_1M" {
+		t.Errorf("Unexpected summaries %v", summaries)
+	}
+	s.Reset()
+	if !math.IsNaN(s.Value()) {
+		t.Errorf("Expected NaN after Reset, got %v", s.Value())
+	}
+
+	a := NewEWMASummarizerWithAlpha("Test", 0.5)
+	for _, v := range []float64{8, 4} {
+		a.Update(&Observation{Timestamp: ts, Name: "Test", Value: v})
+	}
+	// 8 weighs 0.5, 4 weighs 1.
+	if v := a.Value(); math.Abs(v-16.0/3) > 1e-9 {
+		t.Errorf("Expected %v, got %v", 16.0/3, v)
+	}
+	if name := a.Summarize()[0].Name; name != "Test:EWMA_A0.5" {
+		t.Errorf("Unexpected name %v", name)
+	}
+}
+
+func TestFactoryEWMASummarizers(t *testing.T) {
+	tp := newTestPipeline()
+	factory := tp.factory
+	factory.Summarizers = []SummarizerMaker{EWMASummarizers(time.Minute)}
+	o := factory.NewObserver("Latency")
+	defer o.Stop()
+	c := factory.NewCounter("Requests")
+	defer c.Stop()
+	tp.start()
+	o.Observe(3)
+	c.Add(2)
+	tp.sample()
+	tp.expect(t, map[string]float64{
+		"Latency:EWMA_1M":      3,
+		"Requests:EWMA_1M":     2,
+		"Requests/sec:EWMA_1M": 2,
+	})
+}
+
+func TestRateAveragesWithEWMASummarizers(t *testing.T) {
+	tp := newTestPipeline()
+	factory := tp.factory
+	factory.Summarizers = []SummarizerMaker{EWMASummarizers(time.Minute)}
+	factory.RateAverages = []time.Duration{time.Minute}
+	c := factory.NewCounter("Requests")
+	defer c.Stop()
+	tp.start()
+	c.Add(2)
+	tp.sample()
+	tp.expect(t, map[string]float64{
+		"Requests/sec:EWMA_1M":      2,
+		"Requests/sec:RATE_EWMA_1M": 2,
+	})
+}
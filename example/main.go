@@ -6,25 +6,29 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
 	"time"
 )
 
 var factory *telem.Factory = &telem.Factory{
-	Logger:            log.Println,
+	Logger:            telem.NewLogger(os.Stdout),
 	SamplingInterval:  1 * time.Second,
 	SummarizerWindows: []time.Duration{time.Minute, 5 * time.Minute},
+	Quantiles:         []float64{0.5, 0.9, 0.99},
 	HTTPPublisher:     telem.DefaultHTTPPublisher}
 
 func main() {
 	go makeSomeObservations()
-	telem.DefaultHTTPPublisher.SetBaseURL("http://localhost:8888")
-	http.Handle("/", telem.DefaultHTTPPublisher)
+	telem.DefaultHTTPPublisher.Mount(http.DefaultServeMux, "/telemetry")
 	log.Fatal(http.ListenAndServe(":8888", nil))
 }
 
 func makeSomeObservations() {
 	observer := factory.NewObserver("BAPI_Schedule_ExecTime")
+	observer.SetDescription("Time spent executing a schedule")
+	observer.SetUnit("ms")
 	counter := factory.NewCounter("BAPI_Schedule_CallCount")
+	counter.SetDescription("Schedule calls")
 	for {
 		observer.Observe(rand.Float64() * 300)
 		counter.Inc()
@@ -1,24 +1,321 @@
 package gotelem
 
 import (
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
 	"time"
 )
 
+// A Factory holds the configuration shared by a set of instruments.
+// Receivers lists additional receivers which are attached to every
+// instrument created by the factory, next to the HTTPPublisher and
+// Logger. Summarizers lists summarizers to use in addition to the
+// sliding window summarizers given by SummarizerWindows, e.g.
+// CumulativeSummarizers(). Quantiles lists the quantiles computed by
+// the SummarizerWindows summarizers, e.g. 0.5, 0.9 and 0.99, which
+// must be in [0, 1].
+//
+// Time is kept by the Clock, the SystemClock if it is nil. The
+// instruments are sampled by the Scheduler, or by the DefaultScheduler
+// if neither Scheduler nor Clock is set. With only a Clock the factory
+// creates a scheduler of its own using that clock.
+//
+// Counters publish their rate per RateUnit, per second if it is not
+// set, whatever the SamplingInterval. RateAverages lists the windows
+// of the exponentially weighted moving averages of the rate published
+// by counters, e.g. LoadAverageWindows for 1, 5 and 15 minutes. The
+// windows are time constants, as in the load average, and the
+// averages are published as e.g. Requests/sec:RATE_EWMA_1M, apart from
+// the half-life averages of an EWMASummarizer.
+//
+// If Registry is set, observers, counters, gauges and histograms are
+// registered in it and the factory returns the registered instrument
+// if the name is already taken. If the name is taken by another kind
+// of instrument, or by one configured differently, e.g. a histogram
+// with other buckets, NewCounter and friends print a warning and
+// return an instrument which is not published. RegisterCounter and
+// friends return the error instead.
 type Factory struct {
 	Logger            *Logger
 	SamplingInterval  time.Duration
 	SummarizerWindows []time.Duration
+	Quantiles         []float64
+	Summarizers       []SummarizerMaker
 	HTTPPublisher     *HTTPPublisher
+	Receivers         []Receiver
+	Scheduler         *Scheduler
+	Clock             Clock
+	Registry          *Registry
+	RateUnit          time.Duration
+	RateAverages      []time.Duration
+
+	clockScheduler     *Scheduler
+	clockSchedulerOnce sync.Once
 }
 
 func (f *Factory) NewCounter(name string) (c *Counter) {
-	return NewCounter(name, f.SamplingInterval, f.SummarizerWindows, f.HTTPPublisher, f.Logger)
+	c, err := f.RegisterCounter(name)
+	if err != nil {
+		warn(err)
+		c = newCounter(name, f.unpublished())
+	}
+	return
+}
+
+// Returns the counter registered under the name, or creates one, see
+// Factory. Returns a *DuplicateMetricError if the name is taken by
+// another kind of metric.
+func (f *Factory) RegisterCounter(name string) (c *Counter, err error) {
+	if f.Registry == nil {
+		return newCounter(name, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newCounter(name, f) })
+	if c, ok := m.(*Counter); ok {
+		return c, nil
+	}
+	return nil, &DuplicateMetricError{name, m}
+}
+
+func (f *Factory) NewFloatCounter(name string) (c *FloatCounter) {
+	c, err := f.RegisterFloatCounter(name)
+	if err != nil {
+		warn(err)
+		c = newFloatCounter(name, f.unpublished())
+	}
+	return
+}
+
+// Returns the float counter registered under the name, or creates
+// one, see RegisterCounter.
+func (f *Factory) RegisterFloatCounter(name string) (c *FloatCounter, err error) {
+	if f.Registry == nil {
+		return newFloatCounter(name, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newFloatCounter(name, f) })
+	if c, ok := m.(*FloatCounter); ok {
+		return c, nil
+	}
+	return nil, &DuplicateMetricError{name, m}
 }
 
 func (f *Factory) NewObserver(name string) (o *Observer) {
-	return NewObserver(name, f.SamplingInterval, f.SummarizerWindows, f.HTTPPublisher, f.Logger)
+	o, err := f.RegisterObserver(name)
+	if err != nil {
+		warn(err)
+		o = newObserver(name, f.unpublished())
+	}
+	return
+}
+
+// Returns the observer registered under the name, or creates one, see
+// RegisterCounter.
+func (f *Factory) RegisterObserver(name string) (o *Observer, err error) {
+	if f.Registry == nil {
+		return newObserver(name, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newObserver(name, f) })
+	if o, ok := m.(*Observer); ok {
+		return o, nil
+	}
+	return nil, &DuplicateMetricError{name, m}
+}
+
+func (f *Factory) NewGauge(name string) (g *Gauge) {
+	return f.newGauge(name, nil)
+}
+
+// Creates a gauge whose value is the result of calling fn, see
+// NewGaugeFunc.
+func (f *Factory) NewGaugeFunc(name string, fn func() float64) (g *Gauge) {
+	return f.newGauge(name, fn)
+}
+
+func (f *Factory) newGauge(name string, fn func() float64) (g *Gauge) {
+	g, err := f.registerGauge(name, fn)
+	if err != nil {
+		warn(err)
+		g = newGauge(name, fn, f.unpublished())
+	}
+	return
+}
+
+// Returns the gauge registered under the name, or creates one, see
+// RegisterCounter. Returns a *MetricConfigError if the name is taken
+// by a gauge func.
+func (f *Factory) RegisterGauge(name string) (g *Gauge, err error) {
+	return f.registerGauge(name, nil)
+}
+
+// Returns the gauge func registered under the name, or creates one
+// calling fn, see RegisterCounter. Returns a *MetricConfigError if the
+// name is taken by a gauge which is set rather than a gauge func.
+func (f *Factory) RegisterGaugeFunc(name string, fn func() float64) (g *Gauge, err error) {
+	return f.registerGauge(name, fn)
+}
+
+func (f *Factory) registerGauge(name string, fn func() float64) (g *Gauge, err error) {
+	if f.Registry == nil {
+		return newGauge(name, fn, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newGauge(name, fn, f) })
+	g, ok := m.(*Gauge)
+	if !ok {
+		return nil, &DuplicateMetricError{name, m}
+	}
+	if (g.fn == nil) != (fn == nil) {
+		return nil, &MetricConfigError{name, m, "func"}
+	}
+	return g, nil
+}
+
+// Creates a duration observer observing durations in the given unit,
+// e.g. time.Millisecond. It is registered under the given name,
+// without the unit.
+func (f *Factory) NewDurationObserver(name string, unit time.Duration) (d *DurationObserver) {
+	d, err := f.RegisterDurationObserver(name, unit)
+	if err != nil {
+		warn(err)
+		d = newDurationObserver(name, unit, f.unpublished())
+	}
+	return
+}
+
+// Returns the duration observer registered under the name, or creates
+// one, see RegisterCounter. Returns a *MetricConfigError if the
+// registered duration observer has another unit.
+func (f *Factory) RegisterDurationObserver(name string, unit time.Duration) (d *DurationObserver, err error) {
+	if f.Registry == nil {
+		return newDurationObserver(name, unit, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newDurationObserver(name, unit, f) })
+	d, ok := m.(*DurationObserver)
+	if !ok {
+		return nil, &DuplicateMetricError{name, m}
+	}
+	if d.unit != durationUnit(unit) {
+		return nil, &MetricConfigError{name, m, "unit"}
+	}
+	return d, nil
+}
+
+func (f *Factory) NewHistogram(name string, buckets []float64) (h *Histogram) {
+	h, err := f.RegisterHistogram(name, buckets)
+	if err != nil {
+		warn(err)
+		h = newHistogram(name, buckets, f.unpublished())
+	}
+	return
+}
+
+// Returns the histogram registered under the name, or creates one,
+// see RegisterCounter. Returns a *MetricConfigError if the registered
+// histogram has other buckets.
+func (f *Factory) RegisterHistogram(name string, buckets []float64) (h *Histogram, err error) {
+	if f.Registry == nil {
+		return newHistogram(name, buckets, f), nil
+	}
+	m := f.Registry.getOrCreate(name, func() Metric { return newHistogram(name, buckets, f) })
+	h, ok := m.(*Histogram)
+	if !ok {
+		return nil, &DuplicateMetricError{name, m}
+	}
+	if !reflect.DeepEqual(h.bounds, histogramBounds(buckets)) {
+		return nil, &MetricConfigError{name, m, "buckets"}
+	}
+	return h, nil
+}
+
+// Returns a factory for instruments which are neither sampled nor
+// published, what NewCounter and friends return when the name is
+// taken, so that the caller gets a working instrument rather than a
+// panic.
+func (f *Factory) unpublished() *Factory {
+	return &Factory{Clock: f.Clock, RateUnit: f.RateUnit}
+}
+
+func warn(err error) {
+	fmt.Fprintln(os.Stderr, "WARN:", err)
+}
+
+func (f *Factory) NewCallbackObserver(callback func(time.Time) []*Observation) (o *CallbackObserver) {
+	return newCallbackObserver(callback, f)
+}
+
+// Creates a callback observer publishing the number of observations
+// dropped by each of the receivers, see DropCallback. The counts only
+// grow, so the series are counters and are not summarized.
+func (f *Factory) NewDropObserver(receivers map[string]QueuedReceiver) (o *CallbackObserver) {
+	unsummarized := &Factory{
+		Logger:           f.Logger,
+		SamplingInterval: f.SamplingInterval,
+		HTTPPublisher:    f.HTTPPublisher,
+		Receivers:        f.Receivers,
+		Scheduler:        f.scheduler(),
+		Clock:            f.Clock}
+	o = newCallbackObserver(DropCallback(receivers), unsummarized)
+	for name := range receivers {
+		o.setSeriesType(name+"/dropped", "counter")
+	}
+	return
+}
+
+// Makes the summarizers for the named series, set up to use the
+// factory clock.
+func (f *Factory) makeSummarizers(name string) []Summarizer {
+	summarizers := makeSummarizers(name, f.summarizerMakers())
+	for _, s := range summarizers {
+		if c, ok := s.(clocked); ok {
+			c.setClock(f.clock())
+		}
+	}
+	return summarizers
+}
+
+func (f *Factory) summarizerMakers() []SummarizerMaker {
+	return append(slidingWindowSummarizerMakers(f.SummarizerWindows, f.Quantiles...), f.Summarizers...)
+}
+
+func (f *Factory) addReceivers(b *broadcaster) {
+	if f.HTTPPublisher != nil {
+		b.AddReceiver(f.HTTPPublisher)
+	}
+	if f.Logger != nil {
+		b.AddReceiver(f.Logger)
+	}
+	for _, r := range f.Receivers {
+		b.AddReceiver(r)
+	}
+}
+
+func (f *Factory) scheduler() *Scheduler {
+	if f.Scheduler != nil {
+		return f.Scheduler
+	}
+	if f.Clock != nil {
+		f.clockSchedulerOnce.Do(func() {
+			f.clockScheduler = NewSchedulerWithClock(f.Clock)
+		})
+		return f.clockScheduler
+	}
+	return DefaultScheduler
+}
+
+func (f *Factory) rateUnit() time.Duration {
+	if f.RateUnit > 0 {
+		return f.RateUnit
+	}
+	return time.Second
+}
+
+func (f *Factory) newRateTracker() *rateTracker {
+	return newRateTracker(f.rateUnit(), f.SamplingInterval, f.RateAverages)
 }
 
-func (f *Factory) NewCallbackObserver(callback func(time.Time) []*Observation) *CallbackObserver {
-	return NewCallbackObserver(callback, f.SamplingInterval, f.SummarizerWindows, f.HTTPPublisher, f.Logger)
+func (f *Factory) clock() Clock {
+	if f.Clock != nil {
+		return f.Clock
+	}
+	return SystemClock
 }
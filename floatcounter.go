@@ -0,0 +1,143 @@
+package gotelem
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A FloatCounter is a Counter for fractional amounts, like seconds of
+// CPU time or the cost of requests. It publishes the same series as a
+// Counter: the count and its rate, along with the summaries of both.
+// As for a Counter, the count is exposed as a Prometheus counter only
+// if the counter is monotonic.
+type FloatCounter struct {
+	// The bits of the float64 count, updated atomically. Kept first in
+	// the struct so that it is 64-bit aligned on 32-bit platforms.
+	bits      uint64
+	monotonic int32
+	// The sum of the counts at each Reset, guarded by resetMu along
+	// with the swapping of the count in Reset.
+	resets  float64
+	resetMu sync.Mutex
+	name    string
+	*Sampler
+	*broadcaster
+	countSummarizers []Summarizer
+	rateSummarizers  []Summarizer
+	rateUnit         string
+	rate             *rateTracker
+	prevTotal        float64
+}
+
+func NewFloatCounter(name string, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (counter *FloatCounter) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewFloatCounter(name)
+}
+
+func newFloatCounter(name string, f *Factory) (counter *FloatCounter) {
+	counter = &FloatCounter{
+		name:        name,
+		broadcaster: newBroadcaster(name, f),
+		rateUnit:    unitName(f.rateUnit()),
+		rate:        f.newRateTracker()}
+	sample := func(t time.Time) {
+		counter.sample(t)
+	}
+	f.addReceivers(counter.broadcaster)
+	counter.declareSeries(name, CountSeries, f.SamplingInterval, sameUnit)
+	counter.declareSeries(name+"/"+counter.rateUnit, RateSeries, f.SamplingInterval, perUnit(counter.rateUnit))
+	if f.SamplingInterval != 0 {
+		counter.countSummarizers = f.makeSummarizers(name)
+		counter.rateSummarizers = f.makeSummarizers(name + "/" + counter.rateUnit)
+		counter.Sampler = f.scheduler().NewSampler(f.SamplingInterval, sample)
+	}
+	return
+}
+
+func (c *FloatCounter) Name() string {
+	return c.name
+}
+
+// Adds delta, which may be negative, to the count. A monotonic counter
+// ignores negative deltas.
+func (c *FloatCounter) Add(delta float64) {
+	if delta < 0 && atomic.LoadInt32(&c.monotonic) != 0 {
+		return
+	}
+	for {
+		old := atomic.LoadUint64(&c.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&c.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Returns the current count.
+func (c *FloatCounter) Count() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.bits))
+}
+
+// Sets the count back to zero, see Counter.Reset.
+func (c *FloatCounter) Reset() {
+	c.resetMu.Lock()
+	c.resets += math.Float64frombits(atomic.SwapUint64(&c.bits, 0))
+	c.resetMu.Unlock()
+}
+
+// Makes the counter ignore negative deltas.
+func (c *FloatCounter) SetMonotonic(monotonic bool) {
+	var m int32
+	if monotonic {
+		m = 1
+	}
+	atomic.StoreInt32(&c.monotonic, m)
+	c.setSeriesType(c.name, countType(monotonic))
+}
+
+// Resets all the summarizers of the counter, see Summarizer.Reset.
+// The count itself is left as it is.
+func (c *FloatCounter) ResetSummarizers() {
+	for _, s := range c.countSummarizers {
+		s.Reset()
+	}
+	for _, s := range c.rateSummarizers {
+		s.Reset()
+	}
+}
+
+func (c *FloatCounter) sample(t time.Time) {
+	c.resetMu.Lock()
+	count := c.Count()
+	total := count + c.resets
+	c.resetMu.Unlock()
+	delta := total - c.prevTotal
+	c.prevTotal = total
+
+	rateName := c.name + "/" + c.rateUnit
+	observation := &Observation{Timestamp: t, Name: c.name, Value: count}
+	rateObservation := &Observation{Timestamp: t, Name: rateName, Value: c.rate.update(t, delta)}
+	c.broadcast(observation)
+	c.broadcast(rateObservation)
+	for _, obs := range c.rate.averageObservations(t, rateName, nil) {
+		c.broadcast(obs)
+	}
+	for _, s := range c.countSummarizers {
+		s.Update(observation)
+		for _, obs := range s.Summarize() {
+			c.broadcast(obs)
+		}
+	}
+	for _, s := range c.rateSummarizers {
+		s.Update(rateObservation)
+		for _, obs := range s.Summarize() {
+			c.broadcast(obs)
+		}
+	}
+}
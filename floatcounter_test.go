@@ -0,0 +1,28 @@
+package gotelem
+
+import "testing"
+
+func TestFloatCounter(t *testing.T) {
+	tp := newTestPipeline()
+	c := tp.factory.NewFloatCounter("CPU")
+	defer c.Stop()
+	c.SetMonotonic(true)
+	tp.start()
+
+	c.Add(1.5)
+	c.Add(0.25)
+	c.Add(-1)
+	tp.sample()
+	if v := lastValue(t, tp.p, "CPU"); v != 1.75 {
+		t.Errorf("Expected a count of 1.75, got %v", v)
+	}
+	c.Reset()
+	c.Add(0.5)
+	tp.sample()
+	if v := lastValue(t, tp.p, "CPU"); v != 0.5 {
+		t.Errorf("Expected a count of 0.5 after Reset, got %v", v)
+	}
+	if v := lastValue(t, tp.p, "CPU/sec"); v != 0.5 {
+		t.Errorf("Expected a rate of 0.5 after Reset, got %v", v)
+	}
+}
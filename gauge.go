@@ -0,0 +1,164 @@
+package gotelem
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// A Gauge holds a value which can go up and down, like the size of a
+// queue or the number of open connections. Every time the gauge is
+// sampled it publishes its current value along with the summaries of
+// the sampled values. Unlike a Counter no rate series is published.
+//
+// The value is either set with Set and Add, which are safe to use
+// from any number of goroutines, or read from a func each time the
+// gauge is sampled, see NewGaugeFunc.
+//
+// A gauge with labels, as returned by With, holds a value of its own
+// which is sampled together with the gauge it was made from.
+type Gauge struct {
+	// The bits of the float64 value, updated atomically. Kept first in
+	// the struct so that it is 64-bit aligned on 32-bit platforms.
+	bits   uint64
+	name   string
+	labels Labels
+	fn     func() float64
+	*Sampler
+	*broadcaster
+	summarizers []Summarizer
+	// The gauge created by the factory, which keeps track of the
+	// labelled gauges. For that gauge root is itself.
+	root     *Gauge
+	factory  *Factory
+	children labelledSet
+}
+
+func NewGauge(name string, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (gauge *Gauge) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewGauge(name)
+}
+
+// Creates a gauge whose value is the result of calling fn. Fn is
+// called from the sampler goroutine every time the gauge is sampled.
+func NewGaugeFunc(name string, fn func() float64, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (gauge *Gauge) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewGaugeFunc(name, fn)
+}
+
+func newGauge(name string, fn func() float64, f *Factory) (gauge *Gauge) {
+	gauge = &Gauge{
+		name:        name,
+		fn:          fn,
+		broadcaster: newBroadcaster(name, f),
+		factory:     f}
+	gauge.root = gauge
+	sample := func(t time.Time) {
+		gauge.sample(t)
+	}
+	f.addReceivers(gauge.broadcaster)
+	if f.SamplingInterval != 0 {
+		gauge.summarizers = f.makeSummarizers(name)
+		gauge.Sampler = f.scheduler().NewSampler(f.SamplingInterval, sample)
+	}
+	return
+}
+
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+// Returns the labels of the gauge, nil for the gauge created by the
+// factory.
+func (g *Gauge) Labels() Labels {
+	return g.labels
+}
+
+// Returns the gauge for the series with the given labels added to
+// those of g, see Observer.With. A labelled gauge is never backed by a
+// func, its value is set with Set and Add.
+func (g *Gauge) With(keysAndValues ...string) *Gauge {
+	labels := g.labels.with(keysAndValues)
+	root := g.root
+	return root.children.get(labels, func() labelledInstrument {
+		child := &Gauge{
+			name:        root.name,
+			labels:      labels,
+			Sampler:     root.Sampler,
+			broadcaster: root.broadcaster,
+			root:        root}
+		if root.factory.SamplingInterval != 0 {
+			child.summarizers = root.factory.makeSummarizers(root.name)
+		}
+		return child
+	}).(*Gauge)
+}
+
+// Removes the gauge with the given labels added to those of g, see
+// With and Observer.Remove.
+func (g *Gauge) Remove(keysAndValues ...string) bool {
+	labels := g.labels.with(keysAndValues)
+	if !g.root.children.remove(labels) {
+		return false
+	}
+	g.removeLabelledSeries(labels)
+	return true
+}
+
+// Returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	if g.fn != nil {
+		return g.fn()
+	}
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+// Sets the value of the gauge. Has no effect on a gauge backed by a
+// func.
+func (g *Gauge) Set(value float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(value))
+}
+
+// Adds delta, which may be negative, to the value of the gauge. Has no
+// effect on a gauge backed by a func.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&g.bits)
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&g.bits, old, updated) {
+			return
+		}
+	}
+}
+
+// Resets all the summarizers of the gauge, see Summarizer.Reset. The
+// value itself is left as it is. Resetting the gauge created by the
+// factory also resets the labelled gauges made from it.
+func (g *Gauge) ResetSummarizers() {
+	for _, s := range g.summarizers {
+		s.Reset()
+	}
+	g.children.each(func(child labelledInstrument) {
+		child.ResetSummarizers()
+	})
+}
+
+func (g *Gauge) sample(t time.Time) {
+	observation := &Observation{Timestamp: t, Name: g.name, Value: g.Value(), Labels: g.labels}
+	g.broadcast(observation)
+	for _, s := range g.summarizers {
+		s.Update(observation)
+		for _, obs := range setLabels(s.Summarize(), g.labels) {
+			g.broadcast(obs)
+		}
+	}
+	g.children.sample(t)
+}
@@ -0,0 +1,60 @@
+package gotelem
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGauge(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	factory := tp.factory
+	g := factory.NewGauge("QueueSize")
+	defer g.Stop()
+	connections := 3.0
+	f := factory.NewGaugeFunc("Connections", func() float64 { return connections })
+	defer f.Stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				g.Add(1.5)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := g.Value(); v != 1500 {
+		t.Errorf("Expected 1500 after concurrent adds, got %v", v)
+	}
+
+	tp.start()
+	g.Set(10)
+	g.With("queue", "a").Set(2)
+	if g.With("queue", "a").Value() != 2 || g.Value() != 10 {
+		t.Errorf("Expected the labelled gauge to hold a value of its own")
+	}
+	tp.sample()
+	g.Add(-4)
+	connections = 5
+	tp.sample()
+
+	tp.expect(t, map[string]float64{
+		"QueueSize":            6,
+		"QueueSize:1M_MAX":     10,
+		"QueueSize:1M_AVG":     8,
+		"Connections":          5,
+		"Connections:1M_MIN":   3,
+		`QueueSize{queue="a"}`: 2,
+	})
+	for _, name := range g.Series() {
+		if name == "QueueSize/sec" {
+			t.Errorf("Expected no rate series for a gauge")
+		}
+	}
+	if len(g.Series()) != 12 {
+		t.Errorf("Expected the values and 5 summaries of both gauges, got %v", g.Series())
+	}
+}
@@ -40,22 +40,22 @@ func sample(t time.Time) []*telem.Observation {
 	m := &runtime.MemStats{}
 	runtime.ReadMemStats(m)
 	return []*telem.Observation{
-		&telem.Observation{t, "Goruntime_NumGoroutine", float64(runtime.NumGoroutine())},
-		&telem.Observation{t, "Goruntime_NumCgoCall", float64(runtime.NumCgoCall())},
-		&telem.Observation{t, "Goruntime_MemAlloc", float64(m.Alloc)},
-		&telem.Observation{t, "Goruntime_MemTotalAlloc", float64(m.TotalAlloc)},
-		&telem.Observation{t, "Goruntime_MemSys", float64(m.Sys)},
-		&telem.Observation{t, "Goruntime_MemLookups", float64(m.Lookups)},
-		&telem.Observation{t, "Goruntime_MemMallocs", float64(m.Mallocs)},
-		&telem.Observation{t, "Goruntime_MemHeapAlloc", float64(m.HeapAlloc)},
-		&telem.Observation{t, "Goruntime_MemHeapSys", float64(m.HeapSys)},
-		&telem.Observation{t, "Goruntime_MemHeapIdle", float64(m.HeapIdle)},
-		&telem.Observation{t, "Goruntime_MemHeapInuse", float64(m.HeapInuse)},
-		&telem.Observation{t, "Goruntime_MemHeapReleased", float64(m.HeapReleased)},
-		&telem.Observation{t, "Goruntime_MemHeapObjects", float64(m.HeapObjects)},
-		&telem.Observation{t, "Goruntime_MemNextGC", float64(m.NextGC)},
-		&telem.Observation{t, "Goruntime_MemLastGC", float64(m.LastGC)},
-		&telem.Observation{t, "Goruntime_MemPauseTotalNs", float64(m.PauseTotalNs)},
-		&telem.Observation{t, "Goruntime_MemNumGC", float64(m.NumGC)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_NumGoroutine", Value: float64(runtime.NumGoroutine())},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_NumCgoCall", Value: float64(runtime.NumCgoCall())},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemAlloc", Value: float64(m.Alloc)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemTotalAlloc", Value: float64(m.TotalAlloc)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemSys", Value: float64(m.Sys)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemLookups", Value: float64(m.Lookups)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemMallocs", Value: float64(m.Mallocs)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapAlloc", Value: float64(m.HeapAlloc)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapSys", Value: float64(m.HeapSys)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapIdle", Value: float64(m.HeapIdle)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapInuse", Value: float64(m.HeapInuse)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapReleased", Value: float64(m.HeapReleased)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemHeapObjects", Value: float64(m.HeapObjects)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemNextGC", Value: float64(m.NextGC)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemLastGC", Value: float64(m.LastGC)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemPauseTotalNs", Value: float64(m.PauseTotalNs)},
+		&telem.Observation{Timestamp: t, Name: "Goruntime_MemNumGC", Value: float64(m.NumGC)},
 	}
 }
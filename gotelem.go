@@ -4,8 +4,28 @@ import (
 	"time"
 )
 
+// An Observation is a single value of a series. The series is
+// identified by the name together with the labels, if any, see Key.
 type Observation struct {
 	Timestamp time.Time
 	Name      string
 	Value     float64
+	Labels    Labels
+}
+
+// Creates an observation of the series with the given name and labels,
+// given as alternating keys and values like those of Observer.With.
+func NewObservation(timestamp time.Time, name string, value float64, keysAndValues ...string) *Observation {
+	var labels Labels
+	if len(keysAndValues) > 0 {
+		labels = Labels(nil).with(keysAndValues)
+	}
+	return &Observation{Timestamp: timestamp, Name: name, Value: value, Labels: labels}
+}
+
+// Returns the key identifying the series of the observation: the
+// name followed by the labels, e.g. Requests{route="/x"}. Without
+// labels the key is just the name.
+func (o *Observation) Key() string {
+	return o.Name + o.Labels.String()
 }
@@ -3,55 +3,44 @@ package gotelem
 import (
 	"fmt"
 	"math/rand"
+	"net/http/httptest"
 	"os"
-	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
-// Creates a time.Now equivalent that increments it's internal time by
-// `increment` on each invocation.
-func makeMockTimeNow(initial time.Time, increment time.Duration) func() time.Time {
-	t := initial
-	return func() time.Time {
-		t = t.Add(increment)
-		return t.UTC()
-	}
-}
-
 func TestSmokeTestObserver(t *testing.T) {
 	rand.Seed(1337)
+	clock := NewManualClock(time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC))
 	factory := &Factory{
-		Logger:            os.Stdout,
+		Logger:            NewLogger(os.Stdout),
 		SamplingInterval:  time.Second,
 		SummarizerWindows: []time.Duration{time.Minute},
-		HTTPPublisher:     DefaultHTTPPublisher}
+		HTTPPublisher:     DefaultHTTPPublisher,
+		Clock:             clock}
 	observer := factory.NewObserver("BAPI_Schedule_ExecTime")
-	observer.timeNow = makeMockTimeNow(time.Now().UTC(), 100*time.Millisecond)
-
-	// NewObserver must starts a sampler goroutine, give it a chance to start before we continue
-	runtime.Gosched()
-
-	// Now create the fake ticker chan and insert it into the observer
-	fakeTickerChan := make(chan time.Time)
-	observer.setSamplingTicker(&time.Ticker{C: fakeTickerChan})
-
 	counter := factory.NewCounter("BAPI_Schedule_Calls")
-	fakeTickerChanCounter := make(chan time.Time)
-	counter.setSamplingTicker(&time.Ticker{C: fakeTickerChanCounter})
+	defer observer.Stop()
+	defer counter.Stop()
 
+	// Both are sampled every second, so the scheduler sets a single
+	// timer. Wait for it before moving the clock.
+	clock.BlockUntil(1)
 	for i := 1; i <= 100; i++ {
 		observer.Observe(rand.Float64() * 100)
 		counter.Inc()
-		if i%10 == 0 {
-			fakeTickerChan <- observer.timeNow()
-			fakeTickerChanCounter <- observer.timeNow()
-			runtime.Gosched()
-		}
+		// Every 10th advance crosses a second and samples the
+		// observer and counter, wait for the sampling to finish.
+		clock.Advance(100 * time.Millisecond)
+		clock.BlockUntil(1)
 	}
 	// Make the publisher drain it's inbox
-	runtime.Gosched()
 	p := DefaultHTTPPublisher
+	p.Flush()
+	p.mu.RLock()
+	defer p.mu.RUnlock()
 	fmt.Println("series=", len(p.series))
 	for name, s := range p.series {
 		fmt.Printf("  %v: %v\n", name, len(s.store[s.oldestAt:]))
@@ -60,3 +49,58 @@ func TestSmokeTestObserver(t *testing.T) {
 		}
 	}
 }
+
+// Hammers an observer and a counter from several goroutines while the
+// samplers are running and the publisher is being served. Run with
+// -race to catch unsynchronized access.
+func TestConcurrentUse(t *testing.T) {
+	p := NewHTTPPublisher(100)
+	factory := &Factory{
+		SamplingInterval:  time.Millisecond,
+		SummarizerWindows: []time.Duration{time.Minute},
+		HTTPPublisher:     p}
+	observer := factory.NewObserver("Concurrent_Observer")
+	counter := factory.NewCounter("Concurrent_Counter")
+
+	done := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			for _, url := range []string{"/", "/series?q=Concurrent_Observer:1M_AVG&q=Concurrent_Counter"} {
+				p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", url, nil))
+			}
+			p.SetBaseURL("http://localhost")
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				observer.Observe(float64(i))
+				counter.Inc()
+				if i%2 == 0 {
+					counter.Dec()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	observer.Stop()
+	counter.Stop()
+	p.Flush()
+
+	if count := atomic.LoadInt64(&counter.count); count != 4000 {
+		t.Errorf("Expected count 4000, got %v", count)
+	}
+	if len(p.values("Concurrent_Observer")) != 100 {
+		t.Errorf("Expected the publisher to keep 100 raw observations, got %v", len(p.values("Concurrent_Observer")))
+	}
+}
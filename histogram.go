@@ -0,0 +1,227 @@
+package gotelem
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Histogram counts observations into buckets. Every time it is
+// sampled it publishes the cumulative count of each bucket, in the
+// style of Prometheus, as name_bucket with an le label holding the
+// upper bound of the bucket, along with name_sum and name_count:
+//
+//	Latency_bucket{le="0.1"}, Latency_bucket{le="+Inf"}, Latency_sum, Latency_count
+//
+// For each of the SummarizerWindows of the factory it also publishes
+// the counts of the observations within the window, e.g.
+// Latency:1M_BUCKET{le="0.1"}, Latency:1M_SUM and Latency:1M_COUNT.
+type Histogram struct {
+	name string
+	*Sampler
+	*broadcaster
+	mu      sync.Mutex
+	bounds  []float64
+	le      []Labels
+	counts  []int64
+	count   int64
+	sum     float64
+	windows []time.Duration
+	// The cumulative counts at each sample, going back far enough to
+	// compute the counts of the longest window. Only touched from the
+	// sampler goroutine.
+	history []*histogramSnapshot
+}
+
+type histogramSnapshot struct {
+	timestamp time.Time
+	counts    []int64
+	count     int64
+	sum       float64
+}
+
+// Returns count buckets of the given width, the first with the upper
+// bound start.
+func LinearBuckets(start, width float64, count int) []float64 {
+	if count < 1 {
+		panic("LinearBuckets: count must be positive")
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start + float64(i)*width
+	}
+	return buckets
+}
+
+// Returns count buckets where the upper bound of each bucket is factor
+// times the previous one, the first with the upper bound start.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	if count < 1 {
+		panic("ExponentialBuckets: count must be positive")
+	}
+	if start <= 0 || factor <= 1 {
+		panic("ExponentialBuckets: start must be positive and factor greater than 1")
+	}
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start * math.Pow(factor, float64(i))
+	}
+	return buckets
+}
+
+func NewHistogram(name string, buckets []float64, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (histogram *Histogram) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewHistogram(name, buckets)
+}
+
+func newHistogram(name string, buckets []float64, f *Factory) (histogram *Histogram) {
+	bounds := histogramBounds(buckets)
+	histogram = &Histogram{
+		name:        name,
+		broadcaster: newBroadcaster(name, f),
+		bounds:      bounds,
+		le:          make([]Labels, len(bounds)+1),
+		counts:      make([]int64, len(bounds)+1),
+		windows:     f.SummarizerWindows}
+	for i, bound := range bounds {
+		histogram.le[i] = Labels{"le": strconv.FormatFloat(bound, 'g', -1, 64)}
+	}
+	histogram.le[len(bounds)] = Labels{"le": "+Inf"}
+	sample := func(t time.Time) {
+		histogram.sample(t)
+	}
+	f.addReceivers(histogram.broadcaster)
+	histogram.setSeriesType(name, "histogram")
+	histogram.declareSeries(name+"_bucket", CountSeries, f.SamplingInterval, noUnit)
+	histogram.declareSeries(name+"_sum", CountSeries, f.SamplingInterval, sameUnit)
+	histogram.declareSeries(name+"_count", CountSeries, f.SamplingInterval, noUnit)
+	if f.SamplingInterval != 0 {
+		histogram.Sampler = f.scheduler().NewSampler(f.SamplingInterval, sample)
+	}
+	return
+}
+
+// Returns the buckets sorted, without duplicates and without +Inf,
+// which is always the upper bound of the last bucket.
+func histogramBounds(buckets []float64) []float64 {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	bounds := sorted[:0]
+	for _, b := range sorted {
+		if math.IsNaN(b) {
+			panic(fmt.Sprintf("NewHistogram: invalid bucket %v", b))
+		}
+		if !math.IsInf(b, 1) && (len(bounds) == 0 || b != bounds[len(bounds)-1]) {
+			bounds = append(bounds, b)
+		}
+	}
+	return bounds
+}
+
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+// Returns the upper bounds of the buckets, not including the +Inf
+// bound of the last bucket.
+func (h *Histogram) Buckets() []float64 {
+	return append([]float64(nil), h.bounds...)
+}
+
+// Counts the value into the first bucket with an upper bound greater
+// than or equal to the value. NaN is ignored, as it belongs in no
+// bucket and would make the sum NaN for good.
+func (h *Histogram) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	i := sort.SearchFloat64s(h.bounds, value)
+	h.mu.Lock()
+	h.counts[i]++
+	h.count++
+	h.sum += value
+	h.mu.Unlock()
+}
+
+// Returns the cumulative counts of the buckets along with the total
+// count and sum.
+func (h *Histogram) snapshot(t time.Time) *histogramSnapshot {
+	s := &histogramSnapshot{timestamp: t, counts: make([]int64, len(h.counts))}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var cumulative int64
+	for i, c := range h.counts {
+		cumulative += c
+		s.counts[i] = cumulative
+	}
+	s.count = h.count
+	s.sum = h.sum
+	return s
+}
+
+func (h *Histogram) sample(t time.Time) {
+	current := h.snapshot(t)
+	h.publish(t, h.name+"_", "bucket", "sum", "count", current, nil)
+	if len(h.windows) == 0 {
+		return
+	}
+	h.history = append(h.history, current)
+	for _, window := range h.windows {
+		prefix := h.name + ":" + suffix(window) + "_"
+		h.publish(t, prefix, "BUCKET", "SUM", "COUNT", current, h.before(t.Add(-window)))
+	}
+	// Keep the newest snapshot from before the longest window, it is
+	// the baseline of that window.
+	cutoff := t.Add(-h.longestWindow())
+	expired := 0
+	for expired+1 < len(h.history) && !h.history[expired+1].timestamp.After(cutoff) {
+		expired++
+	}
+	if expired > 0 {
+		h.history = append(h.history[:0], h.history[expired:]...)
+	}
+}
+
+// Returns the newest snapshot taken at or before t, or nil if there is
+// none, in which case the window covers every observation so far.
+func (h *Histogram) before(t time.Time) *histogramSnapshot {
+	for i := len(h.history) - 1; i >= 0; i-- {
+		if !h.history[i].timestamp.After(t) {
+			return h.history[i]
+		}
+	}
+	return nil
+}
+
+func (h *Histogram) longestWindow() (longest time.Duration) {
+	for _, window := range h.windows {
+		if window > longest {
+			longest = window
+		}
+	}
+	return
+}
+
+// Publishes the counts of current less those of the baseline, if any.
+func (h *Histogram) publish(t time.Time, prefix, bucket, sum, count string, current, baseline *histogramSnapshot) {
+	for i, c := range current.counts {
+		if baseline != nil {
+			c -= baseline.counts[i]
+		}
+		h.broadcast(&Observation{Timestamp: t, Name: prefix + bucket, Value: float64(c), Labels: h.le[i]})
+	}
+	s, n := current.sum, current.count
+	if baseline != nil {
+		s -= baseline.sum
+		n -= baseline.count
+	}
+	h.broadcast(&Observation{Timestamp: t, Name: prefix + sum, Value: s})
+	h.broadcast(&Observation{Timestamp: t, Name: prefix + count, Value: float64(n)})
+}
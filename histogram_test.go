@@ -0,0 +1,69 @@
+package gotelem
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	linear := LinearBuckets(1, 2, 3)
+	if len(linear) != 3 || linear[0] != 1 || linear[1] != 3 || linear[2] != 5 {
+		t.Errorf("Unexpected linear buckets %v", linear)
+	}
+	exponential := ExponentialBuckets(0.001, 10, 4)
+	if len(exponential) != 4 || exponential[0] != 0.001 || exponential[3] < 0.999999 || exponential[3] > 1.000001 {
+		t.Errorf("Unexpected exponential buckets %v", exponential)
+	}
+	bounds := histogramBounds([]float64{5, 1, 5, 2})
+	if len(bounds) != 3 || bounds[0] != 1 || bounds[1] != 2 || bounds[2] != 5 {
+		t.Errorf("Expected the bounds to be sorted and deduplicated, got %v", bounds)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	tp := newTestPipeline(2 * time.Second)
+	h := tp.factory.NewHistogram("Latency", []float64{0.25, 1})
+	defer h.Stop()
+
+	tp.start()
+	for _, v := range []float64{0.125, 0.25, 0.5, 3, math.NaN()} {
+		h.Observe(v)
+	}
+	tp.sample()
+	h.Observe(0.5)
+	tp.sample()
+	tp.sample()
+
+	tp.expect(t, map[string]float64{
+		`Latency_bucket{le="0.25"}`:    2,
+		`Latency_bucket{le="1"}`:       4,
+		`Latency_bucket{le="+Inf"}`:    5,
+		"Latency_count":                5,
+		"Latency_sum":                  4.375,
+		`Latency:2s_BUCKET{le="0.25"}`: 0,
+		`Latency:2s_BUCKET{le="1"}`:    1,
+		`Latency:2s_BUCKET{le="+Inf"}`: 1,
+		"Latency:2s_COUNT":             1,
+		"Latency:2s_SUM":               0.5,
+	})
+	if len(h.history) != 3 {
+		t.Errorf("Expected the history to be pruned to the window, got %v snapshots", len(h.history))
+	}
+
+	w := httptest.NewRecorder()
+	tp.p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	exposition := "# TYPE Latency histogram\n" +
+		"Latency_bucket{le=\"0.25\"} 2\n" +
+		"Latency_bucket{le=\"1\"} 4\n" +
+		"Latency_bucket{le=\"+Inf\"} 5\n" +
+		"Latency_count 5\n" +
+		"Latency_sum 4.375\n" +
+		"# TYPE Latency_2s histogram\n" +
+		"Latency_2s_bucket{le=\"0.25\"} 0\n"
+	if !strings.Contains(w.Body.String(), exposition) {
+		t.Errorf("Expected the exposition to contain\n%v\ngot:\n%v", exposition, w.Body.String())
+	}
+}
@@ -2,53 +2,109 @@ package gotelem
 
 import (
 	"encoding/json"
-	"fmt"
 	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
 )
 
 var DefaultHTTPPublisher *HTTPPublisher = NewHTTPPublisher(300)
 
 // The HTTP Publisher receives and stores the N latest
 // observations. It implements ServeHTTP and will expose the available
-// time series as JSON data.
+// time series as JSON data, see routes for the endpoints. Series are
+// keyed by Observation.Key, so labelled series are selected with e.g.
+// q=Requests{route="/x"}.
+//
+// The series are updated from the publisher's own goroutine and read
+// by ServeHTTP, so access to them and the baseURL is guarded by mu.
 type HTTPPublisher struct {
 	baseURL string
-	inbox   chan *Observation
+	inbox   *inbox
 	keep    int
+	mu      sync.RWMutex
 	series  map[string]*observationFIFOQueue
+	types   map[string]string
+	infos   map[string]*SeriesInfo
+	// The sequence number of the latest observation, every observation
+	// is numbered as it is added to its series. Used as the cursor of
+	// the streaming endpoints.
+	seq         uint64
+	subscribers map[*subscriber]bool
 }
 
+// Serves the publisher's endpoints, see routes. Use Handler or Mount
+// to serve them under a prefix.
 func (h *HTTPPublisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	fmt.Println(r.URL)
-	localPath := r.URL.Path
-	//println("localPath", localPath)
-	w.Header().Set("Content-Type", "application/json")
-	if localPath == "/" {
-		h.RespondAvailableSeries(w, r)
-	} else if localPath == "/series" {
-		h.RespondSelectedSeries(w, r)
-	}
+	(&publisherMount{publisher: h}).ServeHTTP(w, r)
+}
+
+// The publisher is started by NewHTTPPublisher, so Start does
+// nothing.
+func (h *HTTPPublisher) Start() error {
+	return nil
+}
+
+// Queues the observation for the publisher. The series are updated
+// from the publisher's own goroutine.
+func (h *HTTPPublisher) Receive(o *Observation) {
+	h.inbox.put(o)
+}
+
+// Waits until all received observations have been added to the
+// series.
+func (h *HTTPPublisher) Flush() error {
+	h.inbox.flush()
+	return nil
+}
+
+// Stops the publisher. The series collected so far can still be
+// served.
+func (h *HTTPPublisher) Close() error {
+	h.inbox.close()
+	return nil
 }
 
-func (h *HTTPPublisher) receiverChannel() chan<- *Observation {
-	return h.inbox
+// Sets what happens when observations arrive faster than the publisher
+// can process them. The default policy is DropOldest.
+func (h *HTTPPublisher) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	h.inbox.setOverflowPolicy(policy, timeout)
 }
 
+// Returns the number of observations dropped because of the overflow
+// policy.
+func (h *HTTPPublisher) Dropped() int64 {
+	return h.inbox.droppedCount()
+}
+
+// A series in the listing, along with what it is if the instrument
+// publishing it has described it.
 type timeseries struct {
 	Name string
 	URL  string
+	*SeriesInfo
 }
 
+// Responds with the available series, what they are and the URLs to
+// fetch them from. The URLs are relative to the base URL if one is
+// set, otherwise to the path the publisher is mounted on.
 func (h *HTTPPublisher) RespondAvailableSeries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	h.mu.RLock()
+	baseUrl := h.baseURL
+	if baseUrl == "" {
+		baseUrl, _ = r.Context().Value(mountPathKey{}).(string)
+	}
+	baseUrl += "/series?q="
 	series := make([]*timeseries, len(h.series))
 	i := 0
-	fmt.Println("url=", r.URL.String())
-	baseUrl := h.baseURL + "/series?q="
 	for k, _ := range h.series {
-		series[i] = &timeseries{k, baseUrl + k}
+		series[i] = &timeseries{k, baseUrl + url.QueryEscape(k), h.infos[k]}
 		i++
 	}
+	h.mu.RUnlock()
 	encoder := json.NewEncoder(w)
 	encoder.Encode(series)
 }
@@ -60,49 +116,152 @@ type TimeSeriesPoint struct {
 	Value     float64
 }
 
+// Values which JSON cannot represent, like the NaN average of an empty
+// window, are encoded as null.
+func (p TimeSeriesPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Timestamp int64
+		Value     interface{}
+	}{p.Timestamp, jsonValue(p.Value)})
+}
+
+// Returns the value to encode as JSON, nil for values which JSON
+// cannot represent.
+func jsonValue(value float64) interface{} {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil
+	}
+	return value
+}
+
+// Responds with the points of the series selected by the q and re
+// parameters, see seriesSelection, optionally limited to a time range
+// and downsampled, see seriesQuery. With meta=true the names of the
+// selected series are returned grouped by metric and window instead.
 func (h *HTTPPublisher) RespondSelectedSeries(w http.ResponseWriter, r *http.Request) {
-	selected := r.URL.Query()["q"]
-	fmt.Println("selected=", selected)
+	params := r.URL.Query()
+	selection, err := parseSeriesSelection(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query, err := parseSeriesQuery(params)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	selected := selection.keys(h.seriesKeys())
+	encoder := json.NewEncoder(w)
+	if selection.meta {
+		encoder.Encode(groupSeries(selected, h.histograms()))
+		return
+	}
 	result := make(map[string][]TimeSeriesPoint)
 	for _, name := range selected {
-		seriesData := h.series[name]
-		if seriesData == nil {
+		observations := h.values(name)
+		if observations == nil {
 			continue
 		}
-		observations := seriesData.values()
-		points := make([]TimeSeriesPoint, len(observations))
-		for i, o := range observations {
-			points[i] = TimeSeriesPoint{o.Timestamp.UnixNano(), o.Value}
-		}
-		result[name] = points
+		result[name] = query.points(observations)
 	}
-	encoder := json.NewEncoder(w)
 	encoder.Encode(result)
 }
 
 func NewHTTPPublisher(keep int) *HTTPPublisher {
 	publisher := &HTTPPublisher{
-		keep:   keep,
-		inbox:  make(chan *Observation, 256),
-		series: make(map[string]*observationFIFOQueue)}
-	go publisher.processInbox()
+		keep:        keep,
+		series:      make(map[string]*observationFIFOQueue),
+		types:       make(map[string]string),
+		infos:       make(map[string]*SeriesInfo),
+		subscribers: make(map[*subscriber]bool)}
+	publisher.inbox = newInbox(256, publisher.processObservation)
 	return publisher
 }
 
-func (h *HTTPPublisher) SetBaseURL(url string) {
-	h.baseURL = url
+// Removes the series with the given keys along with their types.
+// Observations already received are processed first, so that none of
+// them bring the series back.
+func (h *HTTPPublisher) RemoveSeries(names ...string) {
+	h.inbox.flush()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, name := range names {
+		delete(h.series, name)
+		delete(h.infos, name)
+		delete(h.types, name)
+	}
+}
+
+// Remembers what the series is, for the listing and the exporters.
+func (h *HTTPPublisher) DescribeSeries(key string, info *SeriesInfo) {
+	h.mu.Lock()
+	h.infos[key] = info
+	h.mu.Unlock()
+}
+
+func (h *HTTPPublisher) setSeriesType(name, typ string) {
+	h.mu.Lock()
+	h.types[name] = typ
+	h.mu.Unlock()
 }
 
-func (h *HTTPPublisher) processInbox() {
-	for {
-		o := <-h.inbox
-		rb := h.series[o.Name]
-		if rb == nil {
-			rb = newObservationRingBuffer(h.keep)
-			h.series[o.Name] = rb
+// Returns the names of the histograms published.
+func (h *HTTPPublisher) histograms() map[string]bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	histograms := make(map[string]bool)
+	for name, typ := range h.types {
+		if typ == "histogram" {
+			histograms[name] = true
 		}
-		rb.update(o)
 	}
+	return histograms
+}
+
+// Sets the URL the series URLs are relative to, e.g.
+// http://example.com/telemetry. By default they are derived from the
+// request.
+func (h *HTTPPublisher) SetBaseURL(baseURL string) {
+	h.mu.Lock()
+	h.baseURL = baseURL
+	h.mu.Unlock()
+}
+
+// Returns the keys of the stored series.
+func (h *HTTPPublisher) seriesKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Returns a copy of the observations stored for the named series, or
+// nil if there is no such series.
+func (h *HTTPPublisher) values(name string) []*Observation {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if rb := h.series[name]; rb != nil {
+		return rb.values()
+	}
+	return nil
+}
+
+func (h *HTTPPublisher) processObservation(o *Observation) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := o.Key()
+	rb := h.series[key]
+	if rb == nil {
+		rb = newObservationRingBuffer(h.keep)
+		h.series[key] = rb
+	}
+	h.seq++
+	rb.updateWithSeq(o, h.seq)
+	h.notify(key, o, h.seq)
 }
 
 func newObservationRingBuffer(keep int) *observationFIFOQueue {
@@ -115,15 +274,23 @@ func newObservationRingBufferWithCapacity(keep int, capacityMultiplier float64)
 	}
 	capacity := int(math.Ceil(float64(keep) * capacityMultiplier))
 	store := make([]*Observation, 0, capacity)
-	return &observationFIFOQueue{store: store, keep: keep}
+	seqs := make([]uint64, 0, capacity)
+	return &observationFIFOQueue{store: store, seqs: seqs, keep: keep}
 }
 
 // FIFO Queue with max size. Reuses the same slice for the lifetime of
 // the queue to avoid generating garbage.
 type observationFIFOQueue struct {
-	store    []*Observation
+	store []*Observation
+	// The sequence numbers of the observations in store, see
+	// HTTPPublisher.seq.
+	seqs     []uint64
 	keep     int
 	oldestAt int
+	// The number of observations discarded so far and the sequence
+	// number of the newest of them.
+	evicted    uint64
+	evictedSeq uint64
 }
 
 func (rb *observationFIFOQueue) values() (values []*Observation) {
@@ -132,15 +299,56 @@ func (rb *observationFIFOQueue) values() (values []*Observation) {
 	return
 }
 
+// Returns the newest observation, or nil if the queue is empty.
+func (rb *observationFIFOQueue) last() *Observation {
+	if len(rb.store) == rb.oldestAt {
+		return nil
+	}
+	return rb.store[len(rb.store)-1]
+}
+
+// Returns copies of the observations with a sequence number greater
+// than seq along with their sequence numbers.
+func (rb *observationFIFOQueue) since(seq uint64) (values []*Observation, seqs []uint64) {
+	stored := rb.seqs[rb.oldestAt:]
+	i := sort.Search(len(stored), func(i int) bool { return stored[i] > seq })
+	values = append(values, rb.store[rb.oldestAt+i:]...)
+	seqs = append(seqs, stored[i:]...)
+	return
+}
+
+// Returns the number of discarded observations with a sequence number
+// greater than seq. That is the gap between seq and the oldest stored
+// observation, at most the number discarded. As the sequence numbers
+// are shared by all series, observations of other series in the gap
+// are counted as well.
+func (rb *observationFIFOQueue) evictedSince(seq uint64) uint64 {
+	if rb.evicted == 0 || rb.evictedSeq <= seq {
+		return 0
+	}
+	missed := rb.seqs[rb.oldestAt] - seq - 1
+	if missed > rb.evicted {
+		return rb.evicted
+	}
+	return missed
+}
+
 func (rb *observationFIFOQueue) update(o *Observation) {
+	rb.updateWithSeq(o, 0)
+}
+
+func (rb *observationFIFOQueue) updateWithSeq(o *Observation, seq uint64) {
 	//println(int(o.Value))
 	if len(rb.store) == cap(rb.store) {
 		// Buffer is full, move all data to start of buffer and reset
 		// oldestAt. Note that we discard the oldest value by slicing
 		// from oldestAt + 1.
 		//println("enter copy", int(o.Value), rb.oldestAt, len(rb.store), cap(rb.store))
+		rb.evict()
 		copy(rb.store, rb.store[rb.oldestAt+1:])
 		rb.store = rb.store[0 : rb.keep-1]
+		copy(rb.seqs, rb.seqs[rb.oldestAt+1:])
+		rb.seqs = rb.seqs[0 : rb.keep-1]
 		//println("copied", rb.oldestAt, len(rb.store), cap(rb.store))
 		rb.oldestAt = 0
 	}
@@ -148,7 +356,15 @@ func (rb *observationFIFOQueue) update(o *Observation) {
 	// will always be 1 less than keep and we already discarded the
 	// oldest value in the copy operation.
 	if len(rb.store) >= rb.keep {
+		rb.evict()
 		rb.oldestAt++
 	}
 	rb.store = append(rb.store, o)
+	rb.seqs = append(rb.seqs, seq)
+}
+
+// Counts the oldest value as discarded.
+func (rb *observationFIFOQueue) evict() {
+	rb.evicted++
+	rb.evictedSeq = rb.seqs[rb.oldestAt]
 }
@@ -1,8 +1,10 @@
 package gotelem
 
 import (
+	"encoding/json"
 	"fmt"
-	"runtime"
+	"math"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -11,15 +13,14 @@ func TestHTTPPublisher(t *testing.T) {
 	// Typical case of a publisher keeping 1 hour of per second data.
 	p := NewHTTPPublisher(3600)
 	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
-	inbox := p.receiverChannel()
 	for i := 0; i < 4; i++ {
 		name := fmt.Sprintf("Test%v", i)
 		for j := 0; j < 5000; j++ {
-			inbox <- &Observation{ts.Add(time.Duration(j) * time.Second), name, float64(j)}
+			p.Receive(&Observation{Timestamp: ts.Add(time.Duration(j) * time.Second), Name: name, Value: float64(j)})
 		}
 	}
 	// Make the publisher drain it's inbox
-	runtime.Gosched()
+	p.Flush()
 
 	fmt.Println("num series=", len(p.series))
 	for name, s := range p.series {
@@ -34,7 +35,7 @@ func TestHTTPPublisher(t *testing.T) {
 
 func _BenchmarkRingBuffer(b *testing.B, keep int, capacity int) {
 	rb := newObservationRingBufferWithCapacity(keep, float64(capacity)/float64(keep))
-	obs := &Observation{time.Now(), "Test", 666.6}
+	obs := &Observation{Timestamp: time.Now(), Name: "Test", Value: 666.6}
 	//ms := &runtime.MemStats{}
 	//runtime.ReadMemStats(ms)
 	//before := ms.Alloc
@@ -118,3 +119,24 @@ keep=1000000 cap=1300000 overhead=1.3: 100000000	        11.4 ns/op
 keep=1000000 cap=1200000 overhead=1.2: 100000000	        13.8 ns/op
 keep=1000000 cap=1100000 overhead=1.1: 100000000	        18.7 ns/op
 */
+
+func TestSeriesWithNaN(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	p.Receive(&Observation{Timestamp: ts, Name: "Test:1M_AVG", Value: math.NaN()})
+	p.Receive(&Observation{Timestamp: ts, Name: "Test:1M_AVG", Value: 1})
+	p.Flush()
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/series?q=Test:1M_AVG", nil))
+	var result map[string][]struct {
+		Timestamp int64
+		Value     *float64
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+	}
+	points := result["Test:1M_AVG"]
+	if len(points) != 2 || points[0].Value != nil || *points[1].Value != 1 {
+		t.Errorf("Expected NaN to be encoded as null, got %v", w.Body.String())
+	}
+}
@@ -0,0 +1,150 @@
+package gotelem
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Labels are key/value pairs which, together with the name, identify
+// a series. They are used for the dimensions of a metric, like the
+// route or status of a request, so that e.g. the request counter is
+// one series per route rather than one metric per route.
+//
+// Labels are shared between the observations of a series and must not
+// be modified once they are in use.
+type Labels map[string]string
+
+// Returns the labels formatted as {key="value",...} with the keys
+// sorted, or the empty string if there are no labels.
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := l.keys()
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '{')
+	for i, k := range keys {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, k...)
+		buf = append(buf, '=')
+		buf = strconv.AppendQuote(buf, l[k])
+	}
+	buf = append(buf, '}')
+	return string(buf)
+}
+
+// Returns the keys, sorted.
+func (l Labels) keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns a copy of the labels with the given keys and values added.
+// The keys and values alternate, so there must be an even number of
+// them.
+func (l Labels) with(keysAndValues []string) Labels {
+	if len(keysAndValues)%2 != 0 {
+		panic("gotelem: labels must be given as key/value pairs, got " + strings.Join(keysAndValues, ", "))
+	}
+	labels := make(Labels, len(l)+len(keysAndValues)/2)
+	for k, v := range l {
+		labels[k] = v
+	}
+	for i := 0; i < len(keysAndValues); i += 2 {
+		labels[keysAndValues[i]] = keysAndValues[i+1]
+	}
+	return labels
+}
+
+// Sets the labels of the observations, which are summaries made by
+// summarizers that only know the name of the series.
+func setLabels(observations []*Observation, labels Labels) []*Observation {
+	if len(labels) != 0 {
+		for _, o := range observations {
+			o.Labels = labels
+		}
+	}
+	return observations
+}
+
+// A labelled instrument, as returned by the With method of an
+// Observer, Counter or Gauge. It is sampled and reset by the
+// instrument it was made from.
+type labelledInstrument interface {
+	sample(t time.Time)
+	ResetSummarizers()
+}
+
+// The labelled instruments made from an instrument, keyed by their
+// labels. Only the instrument created by the factory has any.
+type labelledSet struct {
+	mu       sync.Mutex
+	children map[string]labelledInstrument
+	// Held while the instruments are sampled, so that an instrument is
+	// not sampled once remove has returned.
+	sampling sync.Mutex
+}
+
+// Returns the instrument with the given labels, calling create to make
+// it if there is none.
+func (s *labelledSet) get(labels Labels, create func() labelledInstrument) labelledInstrument {
+	key := labels.String()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	child := s.children[key]
+	if child == nil {
+		child = create()
+		if s.children == nil {
+			s.children = make(map[string]labelledInstrument)
+		}
+		s.children[key] = child
+	}
+	return child
+}
+
+// Removes the instrument with the given labels, waiting for a sample
+// in progress to finish. Returns false if there is none.
+func (s *labelledSet) remove(labels Labels) bool {
+	key := labels.String()
+	s.sampling.Lock()
+	defer s.sampling.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.children[key] == nil {
+		return false
+	}
+	delete(s.children, key)
+	return true
+}
+
+// Samples each of the instruments.
+func (s *labelledSet) sample(t time.Time) {
+	s.sampling.Lock()
+	defer s.sampling.Unlock()
+	s.each(func(child labelledInstrument) {
+		child.sample(t)
+	})
+}
+
+// Calls fn for each of the instruments. The set is not locked while fn
+// runs.
+func (s *labelledSet) each(fn func(labelledInstrument)) {
+	s.mu.Lock()
+	children := make([]labelledInstrument, 0, len(s.children))
+	for _, child := range s.children {
+		children = append(children, child)
+	}
+	s.mu.Unlock()
+	for _, child := range children {
+		fn(child)
+	}
+}
@@ -0,0 +1,122 @@
+package gotelem
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabels(t *testing.T) {
+	o := &Observation{Name: "Requests", Labels: Labels{"status": "200", "route": "/x"}}
+	if key := o.Key(); key != `Requests{route="/x",status="200"}` {
+		t.Errorf("Unexpected key %v", key)
+	}
+	if key := (&Observation{Name: "Requests"}).Key(); key != "Requests" {
+		t.Errorf("Expected the key of an unlabelled observation to be the name, got %v", key)
+	}
+	labels := Labels{"route": "/x"}.with([]string{"status", "500"})
+	if len(labels) != 2 || labels["route"] != "/x" || labels["status"] != "500" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected an odd number of keys and values to panic")
+		}
+	}()
+	Labels(nil).with([]string{"route"})
+}
+
+func TestLabelledInstruments(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	var log bytes.Buffer
+	logger := NewLogger(&log)
+	factory := tp.factory
+	factory.Logger = logger
+
+	observer := factory.NewObserver("Latency")
+	defer observer.Stop()
+	x := observer.With("route", "/x")
+	if observer.With("route", "/x") != x {
+		t.Errorf("Expected the same labels to give the same observer")
+	}
+	if x.With("status", "200") != observer.With("status", "200", "route", "/x") {
+		t.Errorf("Expected labels to be added to those of the observer")
+	}
+	counter := factory.NewCounter("Requests")
+	defer counter.Stop()
+
+	tp.start()
+	observer.Observe(1)
+	x.Observe(10)
+	x.Observe(20)
+	counter.With("route", "/x").Inc()
+	tp.sample()
+	logger.Flush()
+
+	tp.expect(t, map[string]float64{
+		"Latency:1M_AVG":                  1,
+		`Latency:1M_AVG{route="/x"}`:      15,
+		`Latency{route="/x"}`:             20,
+		"Requests":                        0,
+		`Requests{route="/x"}`:            1,
+		`Requests/sec{route="/x"}`:        1,
+		`Requests:1M_MAX{route="/x"}`:     1,
+		`Requests/sec:1M_SUM{route="/x"}`: 1,
+	})
+	if len(tp.p.values(`Latency:1M_AVG{route="/x",status="200"}`)) != 1 {
+		t.Errorf("Expected the labelled observer without observations to be summarized")
+	}
+	if !strings.Contains(log.String(), `,Latency,20.000000,route="/x"`+"\n") {
+		t.Errorf("Expected the labels in the log, got:\n%v", log.String())
+	}
+}
+
+func TestLabelledCallbackObserver(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	observer := tp.factory.NewCallbackObserver(func(t time.Time) []*Observation {
+		return []*Observation{
+			&Observation{Timestamp: t, Name: "Queue", Value: 1, Labels: Labels{"queue": "a"}},
+			&Observation{Timestamp: t, Name: "Queue", Value: 2, Labels: Labels{"queue": "b"}}}
+	})
+	defer observer.Stop()
+	tp.start()
+	tp.sample()
+	for key, value := range map[string]float64{`Queue:1M_MAX{queue="a"}`: 1, `Queue:1M_MAX{queue="b"}`: 2} {
+		if values := tp.p.values(key); len(values) != 1 || values[0].Value != value {
+			t.Errorf("Expected %v to be %v, got %v", key, value, values)
+		}
+	}
+}
+
+func TestRemoveLabelled(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	counter := tp.factory.NewCounter("Requests")
+	defer counter.Stop()
+	tp.start()
+	counter.With("route", "/x").Inc()
+	counter.With("route", "/x", "status", "200").Inc()
+	tp.sample()
+
+	if !counter.With("status", "200").Remove("route", "/x") {
+		t.Errorf("Expected the labelled counter to be removed")
+	}
+	if counter.Remove("route", "/y") {
+		t.Errorf("Expected no counter to remove")
+	}
+	for _, key := range counter.Series() {
+		if strings.Contains(key, "status") {
+			t.Errorf("Series %v still published after Remove", key)
+		}
+	}
+	tp.sample()
+	if tp.p.values(`Requests{route="/x",status="200"}`) != nil {
+		t.Errorf("Expected the removed counter to no longer be sampled")
+	}
+	tp.expect(t, map[string]float64{`Requests{route="/x"}`: 1})
+
+	o := NewObservation(tp.clock.Now(), "Requests", 1, "route", "/x")
+	if o.Key() != `Requests{route="/x"}` {
+		t.Errorf("Unexpected key %v", o.Key())
+	}
+}
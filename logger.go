@@ -4,31 +4,74 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 )
 
 func NewLogger(sink io.Writer) (l *Logger) {
-	l = &Logger{inbox: make(chan *Observation, 128), sink: sink}
-	go l.process()
+	l = &Logger{sink: sink}
+	l.inbox = newInbox(128, l.process)
 	return
 }
 
+// The Logger is a Receiver which writes every observation to its sink
+// as a line of comma separated values: timestamp in nanoseconds, name
+// and value, followed by the labels of the observation, if any, as
+// key="value" in key order.
 type Logger struct {
-	inbox chan *Observation
+	inbox *inbox
 	sink  io.Writer
 }
 
-func (l *Logger) receiverChannel() chan<- *Observation {
-	return l.inbox
+// The logger is started by NewLogger, so Start does nothing.
+func (l *Logger) Start() error {
+	return nil
 }
 
-func (l *Logger) process() {
-	for {
-		o := <-l.inbox
-		if _, err := fmt.Fprintf(l.sink, "%v,%v,%f", o.Timestamp.UnixNano(), o.Name, o.Value); err != nil {
-			fmt.Fprint(os.Stderr, "logger: Error from Fprintf: %s", err)
-		}
-		if _, err := fmt.Fprintln(l.sink); err != nil {
-			fmt.Fprint(os.Stderr, "logger: Error from Fprintln: %s", err)
+func (l *Logger) Receive(o *Observation) {
+	l.inbox.put(o)
+}
+
+// Waits until all received observations have been written. If the
+// sink has a Flush method, like bufio.Writer, it is flushed as well.
+func (l *Logger) Flush() error {
+	l.inbox.flush()
+	if f, ok := l.sink.(interface {
+		Flush() error
+	}); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Writes any pending observations and stops the logger. The sink is
+// not closed.
+func (l *Logger) Close() error {
+	l.inbox.close()
+	return l.Flush()
+}
+
+// Sets what happens when observations arrive faster than the Logger
+// can process them. The default policy is DropOldest.
+func (l *Logger) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	l.inbox.setOverflowPolicy(policy, timeout)
+}
+
+// Returns the number of observations dropped because of the overflow
+// policy.
+func (l *Logger) Dropped() int64 {
+	return l.inbox.droppedCount()
+}
+
+func (l *Logger) process(o *Observation) {
+	if _, err := fmt.Fprintf(l.sink, "%v,%v,%f", o.Timestamp.UnixNano(), o.Name, o.Value); err != nil {
+		fmt.Fprintf(os.Stderr, "logger: Error from Fprintf: %s\n", err)
+	}
+	for _, k := range o.Labels.keys() {
+		if _, err := fmt.Fprintf(l.sink, ",%s=%q", k, o.Labels[k]); err != nil {
+			fmt.Fprintf(os.Stderr, "logger: Error from Fprintf: %s\n", err)
 		}
 	}
+	if _, err := fmt.Fprintln(l.sink); err != nil {
+		fmt.Fprintf(os.Stderr, "logger: Error from Fprintln: %s\n", err)
+	}
 }
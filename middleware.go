@@ -0,0 +1,142 @@
+package gotelem
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPMiddleware records metrics for the requests to the handlers it
+// wraps. All metrics are labelled with the route given to Handler,
+// and named after the prefix given to NewHTTPMiddleware:
+//
+//	<prefix>_Requests      counter of requests
+//	<prefix>_InFlight      gauge of requests being handled
+//	<prefix>_Latency_ms    duration observer of the time taken to handle
+//	                       requests
+//	<prefix>_ResponseBytes observer of the number of bytes written
+//	<prefix>_Responses     counter of responses, also labelled with the
+//	                       status class, e.g. status="2xx"
+//
+// The metrics are created by the factory, so they are published to
+// its HTTPPublisher and registered in its Registry like any other.
+type HTTPMiddleware struct {
+	requests      *Counter
+	inFlight      *Gauge
+	latency       *DurationObserver
+	responseBytes *Observer
+	responses     *Counter
+}
+
+// Creates the metrics of the middleware with the given factory.
+func (f *Factory) NewHTTPMiddleware(prefix string) *HTTPMiddleware {
+	m := &HTTPMiddleware{
+		requests:      f.NewCounter(prefix + "_Requests"),
+		inFlight:      f.NewGauge(prefix + "_InFlight"),
+		latency:       f.NewDurationObserver(prefix+"_Latency", time.Millisecond),
+		responseBytes: f.NewObserver(prefix + "_ResponseBytes"),
+		responses:     f.NewCounter(prefix + "_Responses")}
+	m.requests.SetMonotonic(true)
+	m.responses.SetMonotonic(true)
+	return m
+}
+
+// Returns a handler which calls h and records the metrics of the
+// request under the given route. The route should name a handler, like
+// /users/{id}, rather than be the path of the request, since every
+// route adds series of its own.
+func (m *HTTPMiddleware) Handler(route string, h http.Handler) http.Handler {
+	requests := m.requests.With("route", route)
+	inFlight := m.inFlight.With("route", route)
+	latency := m.latency.With("route", route)
+	responseBytes := m.responseBytes.With("route", route)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		inFlight.Add(1)
+		defer inFlight.Add(-1)
+		rw := &responseRecorder{ResponseWriter: w}
+		stopwatch := latency.StartStopwatch()
+		defer func() {
+			stopwatch.Stop()
+			responseBytes.Observe(float64(rw.written))
+			m.responses.With("route", route, "status", statusClass(rw.status())).Inc()
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// Like Handler, for a handler func.
+func (m *HTTPMiddleware) HandlerFunc(route string, h func(http.ResponseWriter, *http.Request)) http.Handler {
+	return m.Handler(route, http.HandlerFunc(h))
+}
+
+// Stops sampling the metrics of the middleware.
+func (m *HTTPMiddleware) Stop() {
+	m.requests.Stop()
+	m.inFlight.Stop()
+	m.latency.Stop()
+	m.responseBytes.Stop()
+	m.responses.Stop()
+}
+
+// Returns the class of an HTTP status code, e.g. 2xx for 204.
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// Keeps track of the status and the number of bytes written by a
+// handler.
+type responseRecorder struct {
+	http.ResponseWriter
+	code    int
+	written int64
+}
+
+func (rw *responseRecorder) WriteHeader(code int) {
+	if rw.code == 0 {
+		rw.code = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseRecorder) Write(b []byte) (int, error) {
+	if rw.code == 0 {
+		rw.code = http.StatusOK
+	}
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Returns the status written by the handler, 200 if it did not write
+// one.
+func (rw *responseRecorder) status() int {
+	if rw.code == 0 {
+		return http.StatusOK
+	}
+	return rw.code
+}
+
+// Flushes the underlying writer if it can be flushed, so that
+// streaming handlers keep working.
+func (rw *responseRecorder) Flush() {
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijacks the connection if the underlying writer allows it.
+func (rw *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rw.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("gotelem: the ResponseWriter does not support hijacking")
+}
+
+// Returns the underlying writer, for http.ResponseController.
+func (rw *responseRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,46 @@
+package gotelem
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	m := tp.factory.NewHTTPMiddleware("API")
+	defer m.Stop()
+	inFlight := -1.0
+	users := m.HandlerFunc("/users", func(w http.ResponseWriter, r *http.Request) {
+		inFlight = m.inFlight.With("route", "/users").Value()
+		tp.clock.Advance(20 * time.Millisecond)
+		w.Write([]byte("hello"))
+	})
+	missing := m.Handler("/missing", http.NotFoundHandler())
+	tp.start()
+
+	for i := 0; i < 2; i++ {
+		users.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	}
+	w := httptest.NewRecorder()
+	missing.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the response of the handler, got %v", w.Code)
+	}
+	if inFlight != 1 {
+		t.Errorf("Expected one request in flight while handling it, got %v", inFlight)
+	}
+	tp.sample()
+
+	tp.expect(t, map[string]float64{
+		`API_Requests{route="/users"}`:                     2,
+		`API_Requests{route="/missing"}`:                   1,
+		`API_InFlight{route="/users"}`:                     0,
+		`API_Latency_ms:1M_AVG{route="/users"}`:            20,
+		`API_ResponseBytes:1M_SUM{route="/users"}`:         10,
+		`API_Responses{route="/users",status="2xx"}`:       2,
+		`API_Responses{route="/missing",status="4xx"}`:     1,
+		`API_Responses/sec{route="/missing",status="4xx"}`: 1,
+	})
+}
@@ -0,0 +1,186 @@
+package gotelem
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// The MultiWindowSummarizer publishes the same summaries as one
+// SlidingWindowSummarizer per window, but keeps a single list of
+// observations for the largest window. The smaller windows are just
+// later starting points in the same list, so a 1M, 5M and 30M setup
+// stores each observation once instead of three times.
+//
+// The Factory and the New* constructors use a MultiWindowSummarizer
+// whenever more than one summarizer window is given.
+type MultiWindowSummarizer struct {
+	mu          sync.Mutex
+	name        string
+	items       []*Observation
+	windows     []*windowSummary
+	quantiles   []float64
+	sampleLimit int
+	timeNow     func() time.Time
+}
+
+// The running summary of one of the windows. The window holds
+// items[oldestAt:] of the MultiWindowSummarizer.
+type windowSummary struct {
+	maxAge   time.Duration
+	suffix   string
+	oldestAt int
+	sum      float64
+	count    int64
+	min      float64
+	max      float64
+}
+
+// Returns a SummarizerMaker for multi window summarizers over the
+// given windows.
+func MultiWindowSummarizers(windows []time.Duration, quantiles ...float64) SummarizerMaker {
+	checkQuantiles("MultiWindowSummarizers", quantiles)
+	return func(name string) Summarizer {
+		return NewMultiWindowSummarizer(name, windows, quantiles...)
+	}
+}
+
+func NewMultiWindowSummarizer(name string, windows []time.Duration, quantiles ...float64) *MultiWindowSummarizer {
+	checkQuantiles("NewMultiWindowSummarizer", quantiles)
+	s := &MultiWindowSummarizer{
+		name:        name,
+		quantiles:   quantiles,
+		sampleLimit: DefaultQuantileSampleLimit,
+		timeNow:     time.Now}
+	for _, maxAge := range windows {
+		s.windows = append(s.windows, &windowSummary{maxAge: maxAge, suffix: suffix(maxAge)})
+	}
+	s.reset()
+	return s
+}
+
+// Sets the maximum number of window values the quantiles are computed
+// from, see SlidingWindowSummarizer.SetQuantileSampleLimit.
+func (s *MultiWindowSummarizer) SetQuantileSampleLimit(limit int) {
+	s.mu.Lock()
+	s.sampleLimit = limit
+	s.mu.Unlock()
+}
+
+func (s *MultiWindowSummarizer) Update(o *Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, o)
+	now := s.timeNow()
+	for _, w := range s.windows {
+		s.updateWindow(w, o, now)
+	}
+	s.compact()
+}
+
+// Adds the new observation to the window summary and expires the
+// observations that have become too old, much like
+// SlidingWindowSummarizer.Update does.
+func (s *MultiWindowSummarizer) updateWindow(w *windowSummary, o *Observation, now time.Time) {
+	w.sum += o.Value
+	w.count++
+	oldestAcceptable := now.Add(-w.maxAge)
+	expiredMin := math.MaxFloat64
+	expiredMax := -math.MaxFloat64
+	for ; w.oldestAt < len(s.items) && s.items[w.oldestAt].Timestamp.Before(oldestAcceptable); w.oldestAt++ {
+		e := s.items[w.oldestAt]
+		expiredMin = math.Min(expiredMin, e.Value)
+		expiredMax = math.Max(expiredMax, e.Value)
+		w.sum -= e.Value
+		w.count--
+	}
+
+	recomputeMinMax := false
+	if o.Value < w.min {
+		w.min = o.Value
+	} else if expiredMin == w.min {
+		recomputeMinMax = true
+	}
+	if o.Value > w.max {
+		w.max = o.Value
+	} else if expiredMax == w.max {
+		recomputeMinMax = true
+	}
+	if recomputeMinMax || w.count == 0 {
+		w.min, w.max = minMaxObservation(s.items[w.oldestAt:])
+	}
+}
+
+// Moves the items to the start of the list once the oldest item of
+// the largest window is at least halfway to the capacity, like
+// slidingWindow.compact.
+func (s *MultiWindowSummarizer) compact() {
+	oldestAt := len(s.items)
+	for _, w := range s.windows {
+		if w.oldestAt < oldestAt {
+			oldestAt = w.oldestAt
+		}
+	}
+	if oldestAt < cap(s.items)-oldestAt {
+		return
+	}
+	items := len(s.items)
+	copy(s.items, s.items[oldestAt:])
+	for i := items - oldestAt; i < items; i++ {
+		s.items[i] = nil
+	}
+	s.items = s.items[0 : items-oldestAt]
+	for _, w := range s.windows {
+		w.oldestAt -= oldestAt
+	}
+}
+
+func (s *MultiWindowSummarizer) Summarize() []*Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.timeNow().UTC()
+	summaries := make([]*Observation, 0, len(s.windows)*(5+len(s.quantiles)))
+	for _, w := range s.windows {
+		prefix := s.name + ":" + w.suffix + "_"
+		avg := math.NaN()
+		if w.count != 0 {
+			avg = w.sum / float64(w.count)
+		}
+		summaries = append(summaries,
+			&Observation{Timestamp: now, Name: prefix + "MIN", Value: w.min},
+			&Observation{Timestamp: now, Name: prefix + "MAX", Value: w.max},
+			&Observation{Timestamp: now, Name: prefix + "SUM", Value: w.sum},
+			&Observation{Timestamp: now, Name: prefix + "AVG", Value: avg},
+			&Observation{Timestamp: now, Name: prefix + "COUNT", Value: float64(w.count)})
+		if len(s.quantiles) > 0 {
+			sorted := sortedSample(s.items[w.oldestAt:], s.sampleLimit)
+			for _, q := range s.quantiles {
+				summaries = append(summaries, &Observation{Timestamp: now, Name: prefix + quantileSuffix(q), Value: quantile(sorted, q)})
+			}
+		}
+	}
+	return summaries
+}
+
+func (s *MultiWindowSummarizer) setClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeNow = c.Now
+}
+
+func (s *MultiWindowSummarizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reset()
+}
+
+func (s *MultiWindowSummarizer) reset() {
+	s.items = make([]*Observation, 0, 16)
+	for _, w := range s.windows {
+		w.oldestAt = 0
+		w.sum = 0
+		w.count = 0
+		w.min = math.MaxFloat64
+		w.max = -math.MaxFloat64
+	}
+}
@@ -0,0 +1,69 @@
+package gotelem
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// The multi window summarizer must publish exactly what separate
+// sliding window summarizers would.
+func TestMultiWindowSummarizerMatchesSlidingWindows(t *testing.T) {
+	r := rand.New(rand.NewSource(1337))
+	start := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	now := start
+	timeNow := func() time.Time { return now }
+
+	windows := []time.Duration{time.Minute, 5 * time.Minute, 30 * time.Minute}
+	multi := NewMultiWindowSummarizer("Test", windows, 0.5, 0.99)
+	multi.timeNow = timeNow
+	var singles []*SlidingWindowSummarizer
+	for _, w := range windows {
+		s := NewSlidingWindowSummarizer("Test", w, 0.5, 0.99)
+		s.timeNow = timeNow
+		s.window.timeNow = timeNow
+		singles = append(singles, s)
+	}
+
+	for i := 0; i < 5000; i++ {
+		now = now.Add(time.Duration(r.Intn(1000)) * time.Millisecond)
+		o := &Observation{Timestamp: now, Name: "Test", Value: r.Float64() * 100}
+		multi.Update(o)
+		for _, s := range singles {
+			s.Update(o)
+		}
+		if i%100 != 0 {
+			continue
+		}
+		expected := make(map[string]float64)
+		for _, s := range singles {
+			for name, v := range summaryValues(s.Summarize()) {
+				expected[name] = v
+			}
+		}
+		actual := summaryValues(multi.Summarize())
+		if len(actual) != len(expected) {
+			t.Fatalf("Expected %v summaries, got %v", len(expected), len(actual))
+		}
+		for name, v := range expected {
+			if math.Abs(actual[name]-v) > 1e-6 {
+				t.Fatalf("After %v observations: expected %v=%v, got %v", i+1, name, v, actual[name])
+			}
+		}
+	}
+}
+
+func TestFactoryUsesMultiWindowSummarizer(t *testing.T) {
+	factory := &Factory{
+		SamplingInterval:  time.Hour,
+		SummarizerWindows: []time.Duration{time.Minute, 5 * time.Minute}}
+	observer := factory.NewObserver("Test")
+	defer observer.Stop()
+	if len(observer.summarizers) != 1 {
+		t.Fatalf("Expected a single summarizer, got %v", len(observer.summarizers))
+	}
+	if _, ok := observer.summarizers[0].(*MultiWindowSummarizer); !ok {
+		t.Errorf("Expected a MultiWindowSummarizer, got %T", observer.summarizers[0])
+	}
+}
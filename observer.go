@@ -4,52 +4,134 @@ import (
 	"time"
 )
 
+// An Observer publishes the values passed to Observe along with the
+// summaries of them. An observer with labels, as returned by With,
+// publishes a series of its own which is sampled together with the
+// observer it was made from.
 type Observer struct {
-	name string
+	name   string
+	labels Labels
 	*Sampler
-	broadcaster
-	summarizers []*SlidingWindowSummarizer
+	*broadcaster
+	summarizers []Summarizer
 	timeNow     func() time.Time
+	// The observer created by the factory, which keeps track of the
+	// labelled observers. For that observer root is itself.
+	root     *Observer
+	factory  *Factory
+	children labelledSet
+}
+
+func (o *Observer) Name() string {
+	return o.name
+}
+
+// Returns the labels of the observer, nil for the observer created by
+// the factory.
+func (o *Observer) Labels() Labels {
+	return o.labels
 }
 
 func (o *Observer) Observe(value float64) {
-	obs := &Observation{o.timeNow().UTC(), o.name, value}
+	obs := &Observation{Timestamp: o.timeNow().UTC(), Name: o.name, Value: value, Labels: o.labels}
 	for _, s := range o.summarizers {
 		s.Update(obs)
 	}
 	o.broadcast(obs)
 }
 
+// Returns the observer for the series with the given labels added to
+// those of o. The labels are given as alternating keys and values:
+//
+//	observer.With("route", "/x", "status", "200").Observe(v)
+//
+// The same labels always give the same observer. The labelled
+// observer shares the sampler and receivers of o, so stopping either
+// stops both.
+func (o *Observer) With(keysAndValues ...string) *Observer {
+	labels := o.labels.with(keysAndValues)
+	root := o.root
+	return root.children.get(labels, func() labelledInstrument {
+		child := &Observer{
+			name:        root.name,
+			labels:      labels,
+			Sampler:     root.Sampler,
+			broadcaster: root.broadcaster,
+			timeNow:     root.timeNow,
+			root:        root}
+		if root.factory.SamplingInterval != 0 {
+			child.summarizers = root.factory.makeSummarizers(root.name)
+		}
+		return child
+	}).(*Observer)
+}
+
+// Removes the observer with the given labels added to those of o, see
+// With, along with its series from the receivers which keep series,
+// like the HTTPPublisher. Returns false if there is no such observer.
+// The removed observer must not be used afterwards.
+func (o *Observer) Remove(keysAndValues ...string) bool {
+	labels := o.labels.with(keysAndValues)
+	if !o.root.children.remove(labels) {
+		return false
+	}
+	o.removeLabelledSeries(labels)
+	return true
+}
+
 func NewObserver(name string, samplingInterval time.Duration, summarizerWindows []time.Duration, httpPublisher *HTTPPublisher, logger *Logger) (observer *Observer) {
+	factory := &Factory{
+		SamplingInterval:  samplingInterval,
+		SummarizerWindows: summarizerWindows,
+		HTTPPublisher:     httpPublisher,
+		Logger:            logger}
+	return factory.NewObserver(name)
+}
+
+func newObserver(name string, f *Factory) (observer *Observer) {
 	observer = &Observer{
-		name:    name,
-		timeNow: time.Now}
+		name:        name,
+		broadcaster: newBroadcaster(name, f),
+		timeNow:     f.clock().Now,
+		factory:     f}
+	observer.root = observer
 	// TODO(go1.1)
 	// :( http://code.google.com/p/go/issues/detail?id=2280
 	sample := func(t time.Time) {
 		observer.sample(t)
 	}
-	if samplingInterval != 0 {
+	if f.SamplingInterval != 0 {
 		// TODO: There is no sense in having summarizers without a sampler since they won't be sampled but the argument list as it is allows you to specify this
-		observer.Sampler = NewSampler(samplingInterval, sample)
-		observer.summarizers = make([]*SlidingWindowSummarizer, len(summarizerWindows))
-		for i, windowSize := range summarizerWindows {
-			observer.summarizers[i] = NewSlidingWindowSummarizer(name, windowSize)
-		}
-	}
-	if httpPublisher != nil {
-		observer.AddReceiver(httpPublisher)
+		observer.summarizers = f.makeSummarizers(name)
 	}
-	if logger != nil {
-		observer.AddReceiver(logger)
+	// The values are published as they are observed.
+	observer.declareSeries(name, RawSeries, 0, sameUnit)
+	f.addReceivers(observer.broadcaster)
+	// The sampler uses the summarizers, so it must not be started
+	// until the observer is fully set up.
+	if f.SamplingInterval != 0 {
+		observer.Sampler = f.scheduler().NewSampler(f.SamplingInterval, sample)
 	}
 	return
 }
 
 func (o *Observer) sample(t time.Time) {
 	for _, s := range o.summarizers {
-		for _, obs := range s.Summarize() {
+		for _, obs := range setLabels(s.Summarize(), o.labels) {
 			o.broadcast(obs)
 		}
 	}
+	o.children.sample(t)
+}
+
+// Resets all the summarizers of the observer, see Summarizer.Reset.
+// Resetting the observer created by the factory also resets the
+// labelled observers made from it.
+func (o *Observer) ResetSummarizers() {
+	for _, s := range o.summarizers {
+		s.Reset()
+	}
+	o.children.each(func(child labelledInstrument) {
+		child.ResetSummarizers()
+	})
 }
@@ -0,0 +1,69 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+// A testPipeline is what most tests start from: a factory sampling
+// every second, timed by a manual clock and publishing to an
+// HTTPPublisher. Tests adjust the factory before creating instruments.
+type testPipeline struct {
+	clock   *ManualClock
+	p       *HTTPPublisher
+	factory *Factory
+}
+
+// Creates a pipeline summarizing over the given windows.
+func newTestPipeline(windows ...time.Duration) *testPipeline {
+	clock := NewManualClock(time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC))
+	p := NewHTTPPublisher(10)
+	return &testPipeline{clock, p, &Factory{
+		SamplingInterval:  time.Second,
+		SummarizerWindows: windows,
+		HTTPPublisher:     p,
+		Clock:             clock}}
+}
+
+// Waits until the instruments created so far are scheduled.
+func (tp *testPipeline) start() {
+	tp.clock.BlockUntil(1)
+}
+
+// Samples the instruments once and waits until the publisher has the
+// observations.
+func (tp *testPipeline) sample() {
+	sampleOnce(tp.clock)
+	tp.p.Flush()
+}
+
+// Checks the latest value of each of the series.
+func (tp *testPipeline) expect(t *testing.T, expected map[string]float64) {
+	t.Helper()
+	tp.p.Flush()
+	for key, value := range expected {
+		values := tp.p.values(key)
+		if len(values) == 0 {
+			t.Errorf("No series %v", key)
+		} else if last := values[len(values)-1].Value; last != value {
+			t.Errorf("Expected %v to be %v, got %v", key, value, last)
+		}
+	}
+}
+
+// Advances the clock by one sampling interval of a second and waits
+// for the sampling to finish.
+func sampleOnce(clock *ManualClock) {
+	clock.Advance(time.Second)
+	clock.BlockUntil(1)
+}
+
+func lastValue(t *testing.T, p *HTTPPublisher, key string) float64 {
+	t.Helper()
+	p.Flush()
+	values := p.values(key)
+	if len(values) == 0 {
+		t.Fatalf("No series %v", key)
+	}
+	return values[len(values)-1].Value
+}
@@ -0,0 +1,250 @@
+package gotelem
+
+import (
+	"bufio"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The content type of the Prometheus text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Writes the latest value of every series in the Prometheus text
+// exposition format, which is what ServeHTTP responds with on
+// /metrics.
+//
+// Counters and histograms are exposed as such and everything else as
+// gauges, except for the summaries of a window, like Latency:1M_P99 and
+// Latency:1M_COUNT, which are exposed as a Prometheus summary named
+// Latency_1M with a quantile label, and the windows of a histogram,
+// which are exposed as histograms like Latency_1M. The MIN, MAX and
+// AVG of a window are gauges like Latency_1M_max. Note that the sum
+// and count of a sliding window only cover the window. Characters which are not
+// allowed in Prometheus names are replaced by underscores, except for
+// the slash of the rate series of a counter which becomes _per_, as in
+// Requests_per_sec. The description and unit of the instrument, see
+// SeriesInfo, make up the HELP of its families.
+func (h *HTTPPublisher) RespondMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", prometheusContentType)
+	out := bufio.NewWriter(w)
+	for _, family := range h.metricFamilies() {
+		if family.help != "" {
+			out.WriteString("# HELP " + family.name + " " + helpEscaper.Replace(family.help) + "\n")
+		}
+		out.WriteString("# TYPE " + family.name + " " + family.typ + "\n")
+		for _, sample := range family.samples {
+			out.WriteString(sample.String())
+		}
+	}
+	out.Flush()
+}
+
+// The samples sharing a Prometheus metric name and type.
+type metricFamily struct {
+	name    string
+	typ     string
+	help    string
+	samples []*prometheusSample
+}
+
+type prometheusSample struct {
+	name     string
+	labels   Labels
+	quantile string
+	value    float64
+}
+
+// Returns the metric families of the latest observation of every
+// series, sorted by name.
+func (h *HTTPPublisher) metricFamilies() []*metricFamily {
+	h.mu.RLock()
+	latest := make([]*Observation, 0, len(h.series))
+	help := make(map[*Observation]string)
+	for key, rb := range h.series {
+		if o := rb.last(); o != nil {
+			latest = append(latest, o)
+			help[o] = prometheusHelp(h.infos[key])
+		}
+	}
+	types := make(map[string]string, len(h.types))
+	for name, typ := range h.types {
+		types[name] = typ
+	}
+	h.mu.RUnlock()
+
+	families := make(map[string]*metricFamily)
+	for _, o := range latest {
+		familyName, name, typ, quantile := prometheusName(o.Name, types)
+		family := families[familyName]
+		if family == nil {
+			family = &metricFamily{name: familyName, typ: typ}
+			families[familyName] = family
+		}
+		// Pick the longest help, which has the unit if any series of
+		// the family has one, like the sum rather than the count of a
+		// histogram. Ties go to the lesser so that the help does not
+		// depend on the order of the series.
+		if h := help[o]; len(h) > len(family.help) || (len(h) == len(family.help) && h < family.help) {
+			family.help = h
+		}
+		family.samples = append(family.samples, &prometheusSample{name, o.Labels, quantile, o.Value})
+	}
+	sorted := make([]*metricFamily, 0, len(families))
+	for _, family := range families {
+		sort.Slice(family.samples, family.less)
+		sorted = append(sorted, family)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+// Returns the HELP of a series, its description followed by its unit,
+// e.g. "Time spent scheduling (ms)".
+func prometheusHelp(info *SeriesInfo) string {
+	if info == nil {
+		return ""
+	}
+	if info.Unit == "" {
+		return info.Description
+	}
+	return strings.TrimSpace(info.Description + " (" + info.Unit + ")")
+}
+
+// Maps a series name to the name and type of its Prometheus metric
+// family and the name of the sample. For the quantiles of a summary
+// the quantile label is returned as well.
+func prometheusName(name string, types map[string]string) (familyName, sampleName, typ, quantile string) {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		base, summary := name[:i], name[i+1:]
+		if j := strings.LastIndex(summary, "_"); j >= 0 {
+			window, statistic := summary[:j], summary[j+1:]
+			familyName = sanitizeMetricName(base + "_" + window)
+			if types[base] == "histogram" {
+				switch statistic {
+				case "BUCKET", "SUM", "COUNT":
+					return familyName, familyName + "_" + strings.ToLower(statistic), "histogram", ""
+				}
+			}
+			switch statistic {
+			case "MIN", "MAX", "AVG":
+				familyName += "_" + strings.ToLower(statistic)
+				return familyName, familyName, "gauge", ""
+			case "SUM", "COUNT":
+				return familyName, familyName + "_" + strings.ToLower(statistic), "summary", ""
+			}
+			if strings.HasPrefix(statistic, "P") {
+				if q, err := strconv.ParseFloat(statistic[1:], 64); err == nil {
+					return familyName, familyName, "summary", strconv.FormatFloat(q/100, 'g', 12, 64)
+				}
+			}
+		}
+	}
+	for _, part := range []string{"_bucket", "_sum", "_count"} {
+		if base := strings.TrimSuffix(name, part); base != name && types[base] == "histogram" {
+			familyName = sanitizeMetricName(base)
+			return familyName, familyName + part, "histogram", ""
+		}
+	}
+	familyName = sanitizeMetricName(name)
+	typ = types[name]
+	if typ == "" {
+		typ = "gauge"
+	}
+	return familyName, familyName, typ, ""
+}
+
+// Orders the samples by name and labels, with the quantiles of a
+// summary and the buckets of a histogram in increasing order.
+func (f *metricFamily) less(i, j int) bool {
+	a, b := f.samples[i], f.samples[j]
+	if a.name != b.name {
+		return a.name < b.name
+	}
+	aLabels, aBound := a.bound()
+	bLabels, bBound := b.bound()
+	if aLabels != bLabels {
+		return aLabels < bLabels
+	}
+	return aBound < bBound
+}
+
+// Returns the labels other than le, formatted, along with the quantile
+// or upper bucket bound of the sample.
+func (s *prometheusSample) bound() (labels string, bound float64) {
+	bound, _ = strconv.ParseFloat(s.quantile, 64)
+	if le, ok := s.labels["le"]; ok {
+		bound, _ = strconv.ParseFloat(le, 64)
+		others := make(Labels, len(s.labels))
+		for k, v := range s.labels {
+			if k != "le" {
+				others[k] = v
+			}
+		}
+		return others.String(), bound
+	}
+	return s.labels.String(), bound
+}
+
+// Formats the sample line with the labels sorted by key, followed by
+// the quantile label if there is one.
+func (s *prometheusSample) String() string {
+	var b strings.Builder
+	b.WriteString(s.name)
+	if len(s.labels) != 0 || s.quantile != "" {
+		b.WriteByte('{')
+		sep := ""
+		for _, k := range s.labels.keys() {
+			b.WriteString(sep + sanitizeName(k) + `="` + labelValueEscaper.Replace(s.labels[k]) + `"`)
+			sep = ","
+		}
+		if s.quantile != "" {
+			b.WriteString(sep + `quantile="` + s.quantile + `"`)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(s.value, 'g', -1, 64))
+	b.WriteByte('\n')
+	return b.String()
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// HELP text escapes only backslashes and line feeds.
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+// Returns the name as a valid Prometheus metric name. The colon is
+// allowed by Prometheus but reserved for recording rules, so it is
+// replaced like any other character which is not allowed. The slash
+// before the unit of a rate becomes _per_.
+func sanitizeMetricName(name string) string {
+	return sanitizeName(rateSlash.ReplaceAllString(name, "_per_$1$2"))
+}
+
+// Matches the slash of a rate series like Requests/sec.
+var rateSlash = regexp.MustCompile(`/(ns|us|ms|sec|min|hour)([_:]|$)`)
+
+// Returns the name with every character other than letters, digits
+// and underscores replaced by an underscore. A name starting with a
+// digit is prefixed with an underscore.
+func sanitizeName(name string) string {
+	b := make([]byte, 0, len(name)+1)
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+			b = append(b, c)
+		case c >= '0' && c <= '9':
+			if i == 0 {
+				b = append(b, '_')
+			}
+			b = append(b, c)
+		default:
+			b = append(b, '_')
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,76 @@
+package gotelem
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRespondMetrics(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	factory := tp.factory
+	factory.Quantiles = []float64{0.5, 0.999}
+	observer := factory.NewObserver("BAPI.Latency")
+	defer observer.Stop()
+	counter := factory.NewCounter("Requests")
+	defer counter.Stop()
+	counter.SetMonotonic(true)
+	queued := factory.NewCounter("Queued")
+	defer queued.Stop()
+
+	tp.start()
+	observer.With("route", `/"x"`).Observe(10)
+	observer.With("route", `/"x"`).Observe(30)
+	counter.Inc()
+	counter.Inc()
+	tp.sample()
+
+	w := httptest.NewRecorder()
+	tp.p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := w.Header().Get("Content-Type"); contentType != prometheusContentType {
+		t.Errorf("Unexpected content type %v", contentType)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		"# TYPE BAPI_Latency gauge",
+		`BAPI_Latency{route="/\"x\""} 30`,
+		"# TYPE BAPI_Latency_1M summary",
+		`BAPI_Latency_1M_count{route="/\"x\""} 2`,
+		`BAPI_Latency_1M_sum{route="/\"x\""} 40`,
+		`BAPI_Latency_1M{route="/\"x\"",quantile="0.5"} 20`,
+		`BAPI_Latency_1M{route="/\"x\"",quantile="0.999"} 29.98`,
+		"# TYPE BAPI_Latency_1M_max gauge",
+		`BAPI_Latency_1M_max{route="/\"x\""} 30`,
+		"# TYPE Requests counter",
+		"Requests 2",
+		"# TYPE Queued gauge",
+		"Queued 0",
+		"# TYPE Requests_per_sec gauge",
+		"Requests_per_sec 2",
+		"# TYPE Requests_per_sec_1M_avg gauge",
+		"Requests_per_sec_1M_avg 2",
+	} {
+		if !strings.Contains(body, "\n"+expected+"\n") && !strings.HasPrefix(body, expected+"\n") {
+			t.Errorf("Expected the line %v, got:\n%v", expected, body)
+		}
+	}
+	if strings.Count(body, "# TYPE BAPI_Latency_1M summary") != 1 {
+		t.Errorf("Expected the samples of a family to be grouped:\n%v", body)
+	}
+}
+
+func TestSanitizeMetricName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"BAPI_Schedule_ExecTime": "BAPI_Schedule_ExecTime",
+		"Requests/sec":           "Requests_per_sec",
+		"Requests/sec_1M":        "Requests_per_sec_1M",
+		"HTTPPublisher/dropped":  "HTTPPublisher_dropped",
+		"name:5M_AVG":            "name_5M_AVG",
+		"1xx responses":          "_1xx_responses",
+	} {
+		if sanitized := sanitizeMetricName(name); sanitized != expected {
+			t.Errorf("Expected %v to become %v, got %v", name, expected, sanitized)
+		}
+	}
+}
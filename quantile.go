@@ -0,0 +1,64 @@
+package gotelem
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// The default number of observations the quantiles of a
+// SlidingWindowSummarizer are computed from, see
+// SetQuantileSampleLimit.
+const DefaultQuantileSampleLimit = 10000
+
+// Returns the series suffix for a quantile, e.g. P99 for 0.99 and
+// P99.9 for 0.999. The percentage is rounded to 10 significant digits
+// so that 0.07 gives P7 rather than P7.000000000000001.
+func quantileSuffix(q float64) string {
+	return "P" + strconv.FormatFloat(q*100, 'g', 10, 64)
+}
+
+// Panics unless every quantile is in [0, 1], so that a percentage like
+// 99 is caught when the summarizers are set up.
+func checkQuantiles(caller string, quantiles []float64) {
+	for _, q := range quantiles {
+		if !(q >= 0 && q <= 1) {
+			panic(fmt.Sprintf("%v: quantile %v must be in [0, 1]", caller, q))
+		}
+	}
+}
+
+// Returns the q quantile of the sorted values, interpolating linearly
+// between the two closest ranks. Returns NaN if there are no values.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	pos := q * float64(len(sorted)-1)
+	below := int(math.Floor(pos))
+	if below < 0 {
+		return sorted[0]
+	}
+	if below >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	fraction := pos - float64(below)
+	return sorted[below] + fraction*(sorted[below+1]-sorted[below])
+}
+
+// Picks at most limit of the observation values, evenly spread over
+// the observations, and returns them sorted. A limit of 0 means no
+// limit.
+func sortedSample(observations []*Observation, limit int) []float64 {
+	stride := 1
+	if limit > 0 && len(observations) > limit {
+		stride = (len(observations) + limit - 1) / limit
+	}
+	values := make([]float64, 0, len(observations)/stride+1)
+	for i := 0; i < len(observations); i += stride {
+		values = append(values, observations[i].Value)
+	}
+	sort.Float64s(values)
+	return values
+}
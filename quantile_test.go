@@ -0,0 +1,60 @@
+package gotelem
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQuantile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	for q, expected := range map[float64]float64{0: 1, 0.5: 3, 0.9: 4.6, 1: 5} {
+		if v := quantile(sorted, q); math.Abs(v-expected) > 1e-9 {
+			t.Errorf("Expected quantile %v to be %v, got %v", q, expected, v)
+		}
+	}
+	if !math.IsNaN(quantile(nil, 0.5)) {
+		t.Errorf("Quantile of no values should be NaN")
+	}
+	for q, expected := range map[float64]string{0.999: "P99.9", 0.5: "P50", 0.07: "P7", 0.29: "P29", 0.57: "P57"} {
+		if s := quantileSuffix(q); s != expected {
+			t.Errorf("Expected suffix %v for %v, got %v", expected, q, s)
+		}
+	}
+}
+
+func TestSlidingWindowQuantiles(t *testing.T) {
+	s := NewSlidingWindowSummarizer("Test", time.Minute, 0.5, 0.99)
+	now := time.Now().UTC()
+	// Insert 1..1000 in a scrambled order
+	for i := 0; i < 1000; i++ {
+		s.Update(&Observation{Timestamp: now, Name: "Test", Value: float64((i*7919)%1000 + 1)})
+	}
+	values := summaryValues(s.Summarize())
+	if v := values["Test:1M_P50"]; v != 500.5 {
+		t.Errorf("Expected P50=500.5, got %v", v)
+	}
+	if v := values["Test:1M_P99"]; math.Abs(v-990.01) > 1e-9 {
+		t.Errorf("Expected P99=990.01, got %v", v)
+	}
+
+	// With a sample limit the quantiles are approximate
+	s.SetQuantileSampleLimit(100)
+	values = summaryValues(s.Summarize())
+	if v := values["Test:1M_P99"]; math.Abs(v-990) > 20 {
+		t.Errorf("Expected sampled P99 close to 990, got %v", v)
+	}
+}
+
+func TestQuantileOutOfRange(t *testing.T) {
+	for _, q := range []float64{99, -0.1, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected quantile %v to panic", q)
+				}
+			}()
+			(&Factory{SummarizerWindows: []time.Duration{time.Minute}, Quantiles: []float64{q}}).summarizerMakers()
+		}()
+	}
+}
@@ -0,0 +1,61 @@
+package gotelem
+
+import (
+	"math"
+	"time"
+)
+
+// The windows of the moving averages of the load average, for use as
+// Factory.RateAverages.
+var LoadAverageWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// Turns the changes in a count between samples into a rate per unit,
+// along with exponentially weighted moving averages of the rate over
+// the given windows, like the 1, 5 and 15 minute load averages. Only
+// used from the sampler goroutine.
+type rateTracker struct {
+	unit     time.Duration
+	interval time.Duration
+	windows  []time.Duration
+	averages []float64
+	prev     time.Time
+}
+
+func newRateTracker(unit, interval time.Duration, windows []time.Duration) *rateTracker {
+	return &rateTracker{
+		unit:     unit,
+		interval: interval,
+		windows:  windows,
+		averages: make([]float64, len(windows))}
+}
+
+// Returns the rate given the change since the previous sample, and
+// updates the averages. The rate is computed from the time since the
+// previous sample, so a missed sample does not make the rate jump.
+func (r *rateTracker) update(t time.Time, delta float64) (rate float64) {
+	elapsed := r.interval
+	if !r.prev.IsZero() && t.After(r.prev) {
+		elapsed = t.Sub(r.prev)
+	}
+	first := r.prev.IsZero()
+	r.prev = t
+	rate = delta * float64(r.unit) / float64(elapsed)
+	for i, window := range r.windows {
+		if first {
+			r.averages[i] = rate
+		} else {
+			alpha := 1 - math.Exp(-float64(elapsed)/float64(window))
+			r.averages[i] += alpha * (rate - r.averages[i])
+		}
+	}
+	return
+}
+
+// Returns the observations of the averages for the named rate series.
+func (r *rateTracker) averageObservations(t time.Time, name string, labels Labels) []*Observation {
+	observations := make([]*Observation, len(r.windows))
+	for i, window := range r.windows {
+		observations[i] = &Observation{Timestamp: t, Name: name + ":RATE_EWMA_" + suffix(window), Value: r.averages[i], Labels: labels}
+	}
+	return observations
+}
@@ -0,0 +1,69 @@
+package gotelem
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateTracker(t *testing.T) {
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	r := newRateTracker(time.Second, 5*time.Second, []time.Duration{time.Minute})
+	if rate := r.update(ts, 50); rate != 10 {
+		t.Errorf("Expected the first rate to be computed over the interval, got %v", rate)
+	}
+	if r.averages[0] != 10 {
+		t.Errorf("Expected the average to start at the first rate, got %v", r.averages[0])
+	}
+	// A missed sample, 10 seconds since the previous one.
+	if rate := r.update(ts.Add(10*time.Second), 50); rate != 5 {
+		t.Errorf("Expected the rate to be computed over the time since the previous sample, got %v", rate)
+	}
+	expected := 10 + (1-math.Exp(-10.0/60))*(5-10)
+	if math.Abs(r.averages[0]-expected) > 1e-9 {
+		t.Errorf("Expected an average of %v, got %v", expected, r.averages[0])
+	}
+}
+
+func TestCounterRates(t *testing.T) {
+	clock := NewManualClock(time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC))
+	p := NewHTTPPublisher(100)
+	scheduler := NewSchedulerWithClock(clock)
+	factory := &Factory{
+		SamplingInterval: 5 * time.Second,
+		RateAverages:     LoadAverageWindows,
+		HTTPPublisher:    p,
+		Scheduler:        scheduler,
+		Clock:            clock}
+	perSecond := factory.NewCounter("Requests")
+	defer perSecond.Stop()
+	perMinute := (&Factory{
+		SamplingInterval: 5 * time.Second,
+		RateUnit:         time.Minute,
+		HTTPPublisher:    p,
+		Scheduler:        scheduler,
+		Clock:            clock}).NewCounter("Jobs")
+	defer perMinute.Stop()
+
+	clock.BlockUntil(1)
+	for i := 0; i < 60; i++ {
+		perSecond.Add(20)
+		perMinute.Add(1)
+		clock.Advance(5 * time.Second)
+		clock.BlockUntil(1)
+	}
+	if v := lastValue(t, p, "Requests/sec"); v != 4 {
+		t.Errorf("Expected 4 requests/sec, got %v", v)
+	}
+	if v := lastValue(t, p, "Jobs/min"); v != 12 {
+		t.Errorf("Expected 12 jobs/min, got %v", v)
+	}
+	for _, window := range []string{"1M", "5M", "15M"} {
+		if v := lastValue(t, p, "Requests/sec:RATE_EWMA_"+window); math.Abs(v-4) > 1e-9 {
+			t.Errorf("Expected the %v average of a steady rate to be 4, got %v", window, v)
+		}
+	}
+	if len(p.values("Jobs/min:RATE_EWMA_1M")) != 0 {
+		t.Errorf("Expected no averages without RateAverages")
+	}
+}
@@ -0,0 +1,279 @@
+package gotelem
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// A Receiver consumes the observations broadcast by an Observer,
+// Counter or CallbackObserver. The HTTPPublisher and the Logger are
+// both Receivers, and you can attach your own by calling AddReceiver
+// on an instrument or by listing it in Factory.Receivers.
+//
+// Receive is called directly from the goroutine doing the broadcast,
+// which may be the caller of Observe or a sampler goroutine. A
+// Receiver that does slow work (network, disk) should be wrapped with
+// NewAsyncReceiver so that it doesn't hold up the instruments.
+type Receiver interface {
+	// Start prepares the receiver for receiving observations. It is
+	// called once by the owner of the receiver before it is attached
+	// to any instruments.
+	Start() error
+	// Receive is called for every observation broadcast to the
+	// receiver.
+	Receive(o *Observation)
+	// Flush makes sure that all observations received so far have
+	// been fully processed.
+	Flush() error
+	// Close flushes the receiver and releases its resources. No more
+	// observations are processed after Close returns.
+	Close() error
+}
+
+// An OverflowPolicy decides what a queued receiver does when an
+// observation arrives and its queue is full.
+type OverflowPolicy int32
+
+const (
+	// Block the broadcasting goroutine until there is room in the
+	// queue. No observations are lost but a slow receiver will slow
+	// down the instruments.
+	Block OverflowPolicy = iota
+	// Drop the observation that just arrived.
+	DropNewest
+	// Drop the oldest queued observation to make room for the new
+	// one. This is the default, so that a slow receiver never holds
+	// up the instruments, while the latest observations get through.
+	DropOldest
+	// Block until there is room or until the timeout given to
+	// SetOverflowPolicy has passed, in which case the new observation
+	// is dropped.
+	BlockWithTimeout
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "Block"
+	case DropNewest:
+		return "DropNewest"
+	case DropOldest:
+		return "DropOldest"
+	case BlockWithTimeout:
+		return "BlockWithTimeout"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int32(p))
+}
+
+// A QueuedReceiver is a Receiver which queues observations and
+// processes them on its own goroutine. HTTPPublisher, Logger and
+// AsyncReceiver are all QueuedReceivers.
+type QueuedReceiver interface {
+	Receiver
+	// Sets what to do when the queue is full. The timeout is only
+	// used by BlockWithTimeout.
+	SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration)
+	// Returns the number of observations dropped because the queue
+	// was full.
+	Dropped() int64
+}
+
+// Returns a callback for NewCallbackObserver which reports the number
+// of observations dropped so far by each of the receivers. The series
+// are named after the map keys with a "/dropped" suffix, e.g.
+//
+//	factory.NewCallbackObserver(gotelem.DropCallback(map[string]gotelem.QueuedReceiver{
+//		"HTTPPublisher": gotelem.DefaultHTTPPublisher}))
+//
+// publishes the series HTTPPublisher/dropped. Factory.NewDropObserver
+// publishes them as counters.
+func DropCallback(receivers map[string]QueuedReceiver) func(time.Time) []*Observation {
+	return func(t time.Time) []*Observation {
+		observations := make([]*Observation, 0, len(receivers))
+		for name, r := range receivers {
+			observations = append(observations, &Observation{Timestamp: t, Name: name + "/dropped", Value: float64(r.Dropped())})
+		}
+		return observations
+	}
+}
+
+// An AsyncReceiver wraps a Receiver and delivers observations to it
+// from a dedicated goroutine. Receive only queues the observation, so
+// the wrapped Receiver sees all observations from a single goroutine
+// no matter how many instruments it is attached to.
+type AsyncReceiver struct {
+	Receiver
+	inbox *inbox
+}
+
+// Creates an AsyncReceiver that buffers up to size observations for
+// r. The wrapped receiver is not started, call Start on the
+// AsyncReceiver to do that.
+func NewAsyncReceiver(r Receiver, size int) *AsyncReceiver {
+	return &AsyncReceiver{Receiver: r, inbox: newInbox(size, r.Receive)}
+}
+
+func (a *AsyncReceiver) Receive(o *Observation) {
+	a.inbox.put(o)
+}
+
+// Waits for all queued observations to be delivered before flushing
+// the wrapped receiver.
+func (a *AsyncReceiver) Flush() error {
+	a.inbox.flush()
+	return a.Receiver.Flush()
+}
+
+// Delivers the queued observations, stops the delivery goroutine and
+// closes the wrapped receiver.
+func (a *AsyncReceiver) Close() error {
+	a.inbox.close()
+	return a.Receiver.Close()
+}
+
+// Sets what happens when the queue of the AsyncReceiver is full. The
+// default policy is DropOldest.
+func (a *AsyncReceiver) SetOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	a.inbox.setOverflowPolicy(policy, timeout)
+}
+
+func (a *AsyncReceiver) Dropped() int64 {
+	return a.inbox.droppedCount()
+}
+
+// The inbox is a buffered channel of observations drained by a single
+// goroutine which hands each observation to the deliver func. It is
+// what HTTPPublisher, Logger and AsyncReceiver use to decouple the
+// instruments from the actual processing.
+type inbox struct {
+	// Accessed atomically since the policy can be changed while
+	// observations are being put. The 64-bit fields come first to
+	// keep them aligned on 32-bit platforms.
+	timeout int64
+	dropped int64
+	policy  int32
+	c       chan *Observation
+	flushes chan chan bool
+	closing chan bool
+	done    chan bool
+	deliver func(*Observation)
+}
+
+func newInbox(size int, deliver func(*Observation)) *inbox {
+	i := &inbox{
+		c:       make(chan *Observation, size),
+		flushes: make(chan chan bool),
+		closing: make(chan bool),
+		done:    make(chan bool),
+		deliver: deliver,
+		policy:  int32(DropOldest)}
+	go i.process()
+	return i
+}
+
+func (i *inbox) setOverflowPolicy(policy OverflowPolicy, timeout time.Duration) {
+	atomic.StoreInt64(&i.timeout, int64(timeout))
+	atomic.StoreInt32(&i.policy, int32(policy))
+}
+
+func (i *inbox) droppedCount() int64 {
+	return atomic.LoadInt64(&i.dropped)
+}
+
+// Queues an observation for delivery, applying the overflow policy if
+// the queue is full. Observations put after the inbox has been closed
+// are discarded without being counted as dropped.
+func (i *inbox) put(o *Observation) {
+	// Fast path, there is room in the queue.
+	select {
+	case i.c <- o:
+		return
+	case <-i.done:
+		return
+	default:
+	}
+	switch OverflowPolicy(atomic.LoadInt32(&i.policy)) {
+	case DropNewest:
+		atomic.AddInt64(&i.dropped, 1)
+	case DropOldest:
+		for {
+			select {
+			case i.c <- o:
+				return
+			case <-i.done:
+				return
+			default:
+			}
+			// The queue may have been drained in the meantime, so
+			// don't wait for an observation to discard.
+			select {
+			case <-i.c:
+				atomic.AddInt64(&i.dropped, 1)
+			default:
+			}
+		}
+	case BlockWithTimeout:
+		timer := time.NewTimer(time.Duration(atomic.LoadInt64(&i.timeout)))
+		defer timer.Stop()
+		select {
+		case i.c <- o:
+		case <-i.done:
+		case <-timer.C:
+			atomic.AddInt64(&i.dropped, 1)
+		}
+	default:
+		select {
+		case i.c <- o:
+		case <-i.done:
+		}
+	}
+}
+
+// Blocks until every observation put before the call has been
+// delivered.
+func (i *inbox) flush() {
+	flushed := make(chan bool)
+	select {
+	case i.flushes <- flushed:
+		<-flushed
+	case <-i.done:
+	}
+}
+
+// Delivers everything that is queued and stops the goroutine. It is
+// safe to call close more than once.
+func (i *inbox) close() {
+	select {
+	case i.closing <- true:
+		<-i.done
+	case <-i.done:
+	}
+}
+
+func (i *inbox) process() {
+	for {
+		select {
+		case o := <-i.c:
+			i.deliver(o)
+		case flushed := <-i.flushes:
+			i.drain()
+			close(flushed)
+		case <-i.closing:
+			i.drain()
+			close(i.done)
+			return
+		}
+	}
+}
+
+func (i *inbox) drain() {
+	for {
+		select {
+		case o := <-i.c:
+			i.deliver(o)
+		default:
+			return
+		}
+	}
+}
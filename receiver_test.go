@@ -0,0 +1,152 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+// Receiver which records everything it is given along with the
+// lifecycle calls.
+type recordingReceiver struct {
+	started      bool
+	flushes      int
+	closed       bool
+	observations []*Observation
+}
+
+func (r *recordingReceiver) Start() error {
+	r.started = true
+	return nil
+}
+
+func (r *recordingReceiver) Receive(o *Observation) {
+	r.observations = append(r.observations, o)
+}
+
+func (r *recordingReceiver) Flush() error {
+	r.flushes++
+	return nil
+}
+
+func (r *recordingReceiver) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestAsyncReceiver(t *testing.T) {
+	r := &recordingReceiver{}
+	a := NewAsyncReceiver(r, 4)
+	a.SetOverflowPolicy(Block, 0)
+	if err := a.Start(); err != nil || !r.started {
+		t.Fatalf("Start should start the wrapped receiver, err=%v", err)
+	}
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		a.Receive(&Observation{Timestamp: ts, Name: "Test", Value: float64(i)})
+	}
+	a.Flush()
+	if len(r.observations) != 100 {
+		t.Fatalf("Expected 100 observations after Flush, got %v", len(r.observations))
+	}
+	for i, o := range r.observations {
+		if o.Value != float64(i) {
+			t.Fatalf("Observations delivered out of order, got %v at %v", o.Value, i)
+		}
+	}
+	if r.flushes != 1 {
+		t.Errorf("Flush should flush the wrapped receiver once, got %v", r.flushes)
+	}
+	a.Close()
+	if !r.closed {
+		t.Errorf("Close should close the wrapped receiver")
+	}
+	// Observations received after Close are discarded and must not block.
+	a.Receive(&Observation{Timestamp: ts, Name: "Test", Value: 666})
+	if len(r.observations) != 100 {
+		t.Errorf("Observation received after Close was delivered")
+	}
+}
+
+func TestFactoryReceivers(t *testing.T) {
+	r := &recordingReceiver{}
+	factory := &Factory{Receivers: []Receiver{r}}
+	factory.NewObserver("Test").Observe(42)
+	factory.NewCallbackObserver(func(time.Time) []*Observation { return nil })
+	if len(r.observations) != 1 {
+		t.Fatalf("Expected 1 observation, got %v", len(r.observations))
+	}
+	if o := r.observations[0]; o.Name != "Test" || o.Value != 42 {
+		t.Errorf("Unexpected observation %v", *o)
+	}
+}
+
+// Receiver which blocks in Receive until released.
+type stalledReceiver struct {
+	recordingReceiver
+	receiving chan bool
+	release   chan bool
+}
+
+func (r *stalledReceiver) Receive(o *Observation) {
+	r.receiving <- true
+	<-r.release
+	r.recordingReceiver.Receive(o)
+}
+
+func TestOverflowPolicies(t *testing.T) {
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	for _, policy := range []OverflowPolicy{DropNewest, DropOldest, BlockWithTimeout} {
+		r := &stalledReceiver{receiving: make(chan bool), release: make(chan bool)}
+		a := NewAsyncReceiver(r, 2)
+		a.SetOverflowPolicy(policy, time.Millisecond)
+		// The first observation is picked up and stalls the receiver,
+		// the next two fill the queue and the last three overflow.
+		a.Receive(&Observation{Timestamp: ts, Name: "Test", Value: 0})
+		<-r.receiving
+		for i := 1; i < 6; i++ {
+			a.Receive(&Observation{Timestamp: ts, Name: "Test", Value: float64(i)})
+		}
+		if a.Dropped() != 3 {
+			t.Errorf("%v: expected 3 dropped observations, got %v", policy, a.Dropped())
+		}
+		close(r.release)
+		go func() {
+			for range r.receiving {
+			}
+		}()
+		a.Close()
+		close(r.receiving)
+		expected := []float64{0, 1, 2}
+		if policy == DropOldest {
+			expected = []float64{0, 4, 5}
+		}
+		if len(r.observations) != len(expected) {
+			t.Fatalf("%v: expected %v observations, got %v", policy, len(expected), len(r.observations))
+		}
+		for i, o := range r.observations {
+			if o.Value != expected[i] {
+				t.Errorf("%v: expected %v at %v, got %v", policy, expected[i], i, o.Value)
+			}
+		}
+	}
+}
+
+func TestDropObserver(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	a := NewAsyncReceiver(&recordingReceiver{}, 4)
+	if policy := OverflowPolicy(a.inbox.policy); policy != DropOldest {
+		t.Errorf("Expected DropOldest to be the default policy, got %v", policy)
+	}
+	o := tp.factory.NewDropObserver(map[string]QueuedReceiver{"HTTPPublisher": tp.p, "Async": a})
+	defer o.Stop()
+	tp.start()
+	tp.sample()
+
+	tp.expect(t, map[string]float64{"HTTPPublisher/dropped": 0, "Async/dropped": 0})
+	if series := o.Series(); len(series) != 2 {
+		t.Errorf("Expected the dropped counts not to be summarized, got %v", series)
+	}
+	if typ := tp.p.types["HTTPPublisher/dropped"]; typ != "counter" {
+		t.Errorf("Expected the dropped count to be a counter, got %q", typ)
+	}
+}
@@ -0,0 +1,137 @@
+package gotelem
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Metric is an instrument that can be kept in a Registry. Observer,
+// Counter, FloatCounter, Gauge, Histogram, DurationObserver and
+// CallbackObserver are all Metrics.
+type Metric interface {
+	// Returns the names of the series the metric has published.
+	Series() []string
+	// Stops sampling the metric.
+	Stop()
+}
+
+// A Registry keeps track of metrics by name. A Factory with a Registry
+// registers every observer, counter, gauge and histogram it creates,
+// and returns the existing instrument when asked for one with a name
+// that is already registered, so that two parts of a program asking
+// for the same metric share it rather than publishing interleaved
+// series.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]Metric
+}
+
+// A registry for programs that need just one. It is not used unless a
+// Factory is told to, e.g. &Factory{Registry: DefaultRegistry}.
+var DefaultRegistry *Registry = NewRegistry()
+
+// Returned by Register when the name is already taken.
+type DuplicateMetricError struct {
+	Name     string
+	Existing Metric
+}
+
+func (e *DuplicateMetricError) Error() string {
+	return fmt.Sprintf("gotelem: a %T is already registered as %q", e.Existing, e.Name)
+}
+
+// Returned by the Register methods of a Factory when the name is
+// registered with another configuration, e.g. a histogram with other
+// buckets.
+type MetricConfigError struct {
+	Name     string
+	Existing Metric
+	// What differs: buckets, unit or func.
+	Setting string
+}
+
+func (e *MetricConfigError) Error() string {
+	return fmt.Sprintf("gotelem: a %T with a different %s is already registered as %q", e.Existing, e.Setting, e.Name)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]Metric)}
+}
+
+// Registers the metric under the given name. If the name is taken a
+// *DuplicateMetricError holding the registered metric is returned.
+func (r *Registry) Register(name string, m Metric) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing := r.metrics[name]; existing != nil {
+		return &DuplicateMetricError{name, existing}
+	}
+	r.metrics[name] = m
+	return nil
+}
+
+// Returns the metric registered under the name, or nil.
+func (r *Registry) Get(name string) Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metrics[name]
+}
+
+// Returns the metric registered under the name, or creates and
+// registers it if there is none. Create is called with the registry
+// locked.
+func (r *Registry) getOrCreate(name string, create func() Metric) Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m := r.metrics[name]
+	if m == nil {
+		m = create()
+		r.metrics[name] = m
+	}
+	return m
+}
+
+// Removes the named metric from the registry, stops it and removes
+// its series from the receivers that keep series, like the
+// HTTPPublisher. Returns false if no metric was registered under the
+// name.
+func (r *Registry) Unregister(name string) bool {
+	r.mu.Lock()
+	m := r.metrics[name]
+	delete(r.metrics, name)
+	r.mu.Unlock()
+	if m == nil {
+		return false
+	}
+	m.Stop()
+	if b, ok := m.(interface {
+		removeSeries()
+	}); ok {
+		b.removeSeries()
+	}
+	return true
+}
+
+// Returns the names of the registered metrics, sorted.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Calls fn for each registered metric, in name order. The registry
+// is not locked while fn runs, so fn may register and unregister
+// metrics.
+func (r *Registry) Each(fn func(name string, m Metric)) {
+	for _, name := range r.Names() {
+		if m := r.Get(name); m != nil {
+			fn(name, m)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	p := tp.p
+	registry := NewRegistry()
+	factory := tp.factory
+	factory.Registry = registry
+
+	observer := factory.NewObserver("Latency")
+	if factory.NewObserver("Latency") != observer {
+		t.Errorf("Expected the registered observer to be returned")
+	}
+	counter := factory.NewCounter("Calls")
+	if _, err := factory.RegisterCounter("Latency"); err == nil || err.(*DuplicateMetricError).Existing != observer {
+		t.Errorf("Expected a DuplicateMetricError holding the observer, got %v", err)
+	}
+	if c := factory.NewCounter("Latency"); c == nil || len(c.receivers) != 0 || c.Sampler != nil {
+		t.Errorf("Expected an unpublished counter when the name is taken")
+	}
+	histogram := factory.NewHistogram("Size", []float64{1, 10})
+	if h, err := factory.RegisterHistogram("Size", []float64{10, 1, 1}); h != histogram || err != nil {
+		t.Errorf("Expected the same buckets to give the registered histogram, got %v", err)
+	}
+	if _, err := factory.RegisterHistogram("Size", []float64{1, 100}); err == nil || err.(*MetricConfigError).Setting != "buckets" {
+		t.Errorf("Expected a MetricConfigError for other buckets, got %v", err)
+	}
+	factory.NewDurationObserver("Wait", time.Millisecond)
+	if _, err := factory.RegisterDurationObserver("Wait", time.Second); err == nil || err.(*MetricConfigError).Setting != "unit" {
+		t.Errorf("Expected a MetricConfigError for another unit, got %v", err)
+	}
+	factory.NewGauge("Level")
+	if _, err := factory.RegisterGaugeFunc("Level", func() float64 { return 1 }); err == nil || err.(*MetricConfigError).Setting != "func" {
+		t.Errorf("Expected a MetricConfigError for a gauge func, got %v", err)
+	}
+	for _, name := range []string{"Size", "Wait", "Level"} {
+		registry.Unregister(name)
+	}
+	if err := registry.Register("Calls", counter); err == nil {
+		t.Errorf("Expected an error registering a taken name")
+	} else if err.(*DuplicateMetricError).Existing != counter {
+		t.Errorf("Expected the error to hold the registered counter")
+	}
+	callbackObserver := factory.NewCallbackObserver(func(t time.Time) []*Observation {
+		return []*Observation{&Observation{Timestamp: t, Name: "Goroutines", Value: 1}}
+	})
+	if err := registry.Register("Goroutines", callbackObserver); err != nil {
+		t.Errorf("Unexpected error registering a callback observer: %v", err)
+	}
+	names := registry.Names()
+	if len(names) != 3 || names[0] != "Calls" || names[1] != "Goroutines" || names[2] != "Latency" {
+		t.Errorf("Unexpected names %v", names)
+	}
+
+	tp.start()
+	observer.Observe(42)
+	counter.Inc()
+	tp.sample()
+	if len(observer.Series()) != 6 {
+		t.Errorf("Expected the observer to have published 6 series, got %v", observer.Series())
+	}
+
+	if !registry.Unregister("Latency") {
+		t.Errorf("Expected Unregister to find the observer")
+	}
+	if registry.Unregister("Latency") {
+		t.Errorf("Expected the observer to be gone after Unregister")
+	}
+	for _, name := range observer.Series() {
+		if p.values(name) != nil {
+			t.Errorf("Series %v still published after Unregister", name)
+		}
+	}
+	if p.values("Calls") == nil || p.values("Goroutines") == nil {
+		t.Errorf("Unregister removed the series of other metrics")
+	}
+	if factory.NewObserver("Latency") == observer {
+		t.Errorf("Expected a new observer after Unregister")
+	}
+	factory.NewHistogram("Size", []float64{1})
+	registry.Unregister("Size")
+	if typ := p.types["Size"]; typ != "" {
+		t.Errorf("Expected the type of the histogram to be removed with it, got %v", typ)
+	}
+	registry.Each(func(name string, m Metric) {
+		m.Stop()
+	})
+}
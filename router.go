@@ -0,0 +1,130 @@
+package gotelem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The endpoints of the HTTPPublisher, keyed by their path relative to
+// where the publisher is mounted.
+var routes = map[string]func(*HTTPPublisher, http.ResponseWriter, *http.Request){
+	"/":          (*HTTPPublisher).RespondAvailableSeries,
+	"/series":    (*HTTPPublisher).RespondSelectedSeries,
+	"/metrics":   (*HTTPPublisher).RespondMetrics,
+	"/stream":    (*HTTPPublisher).RespondStream,
+	"/poll":      (*HTTPPublisher).RespondPoll,
+	"/dashboard": (*HTTPPublisher).RespondDashboard,
+}
+
+// All endpoints are read only.
+const allowedMethods = "GET, HEAD"
+
+// The endpoints which only answer GET, as a HEAD request would wait
+// for points without a body to send them in.
+var streamingRoutes = map[string]bool{"/stream": true, "/poll": true}
+
+// The context key holding the path the publisher is mounted on, see
+// mountPath.
+type mountPathKey struct{}
+
+// A publisherMount serves the publisher under a path prefix.
+type publisherMount struct {
+	publisher *HTTPPublisher
+	prefix    string
+}
+
+// Returns a handler serving the publisher under prefix, e.g.
+// /telemetry. The handler works both when registered directly and when
+// wrapped in http.StripPrefix.
+func (h *HTTPPublisher) Handler(prefix string) http.Handler {
+	return &publisherMount{h, strings.TrimSuffix(prefix, "/")}
+}
+
+// Registers the publisher on mux under prefix, so that the series are
+// listed on prefix/ and served from prefix/series.
+func (h *HTTPPublisher) Mount(mux *http.ServeMux, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	mux.Handle(prefix+"/", h.Handler(prefix))
+}
+
+func (m *publisherMount) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	localPath := r.URL.Path
+	if m.prefix != "" && (localPath == m.prefix || strings.HasPrefix(localPath, m.prefix+"/")) {
+		localPath = localPath[len(m.prefix):]
+	}
+	localPath = cleanPath(localPath)
+	respond, ok := routes[localPath]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("no such endpoint: %s", r.URL.Path))
+		return
+	}
+	allowed := allowedMethods
+	if streamingRoutes[localPath] {
+		allowed = "GET"
+	}
+	if r.Method != "GET" && (r.Method != "HEAD" || streamingRoutes[localPath]) {
+		w.Header().Set("Allow", allowed)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+		return
+	}
+	mount := mountPath(r, localPath, m.prefix)
+	if localPath == "/dashboard" && strings.HasSuffix(r.URL.Path, "/") {
+		// The dashboard fetches the series relative to its own URL,
+		// which only leads back to the publisher without the slash.
+		target := mount + localPath
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	ctx := context.WithValue(r.Context(), mountPathKey{}, mount)
+	respond(m.publisher, w, r.WithContext(ctx))
+}
+
+// Returns the path with a leading slash and without a trailing one,
+// except for the root.
+func cleanPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return path.Clean("/" + p)
+}
+
+// Returns the path the publisher is mounted on, derived by removing
+// the local path from the path the client requested. Works out the
+// prefix removed by http.StripPrefix, which is not otherwise visible
+// to the handler. Falls back to prefix if the paths disagree.
+func mountPath(r *http.Request, localPath, prefix string) string {
+	requested := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		requested = u.Path
+	}
+	requested = cleanPath(requested)
+	if localPath == "/" {
+		localPath = ""
+	}
+	if !strings.HasSuffix(requested, localPath) {
+		return prefix
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(requested, localPath), "/")
+}
+
+type errorResponse struct {
+	Error  string
+	Status int
+}
+
+// Responds with the error as a JSON object, e.g.
+// {"Error":"no such endpoint: /x","Status":404}.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&errorResponse{message, status})
+}
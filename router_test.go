@@ -0,0 +1,74 @@
+package gotelem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	p.Receive(&Observation{Timestamp: time.Unix(1, 0), Name: "Test", Value: 1})
+	p.Flush()
+
+	stripped := http.NewServeMux()
+	stripped.Handle("/telemetry/", http.StripPrefix("/telemetry", p))
+	mounted := http.NewServeMux()
+	p.Mount(mounted, "/telemetry/")
+
+	for name, handler := range map[string]http.Handler{"root": p, "stripped": stripped, "mounted": mounted} {
+		prefix := "/telemetry"
+		if name == "root" {
+			prefix = ""
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", prefix+"/", nil))
+		var series []*timeseries
+		if err := json.Unmarshal(w.Body.Bytes(), &series); err != nil {
+			t.Fatalf("%s: invalid series listing %q: %v", name, w.Body.String(), err)
+		}
+		if len(series) != 1 || series[0].URL != prefix+"/series?q=Test" {
+			t.Errorf("%s: unexpected series URL in %s", name, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", series[0].URL, nil))
+		if w.Code != 200 || w.Body.String() != "{\"Test\":[{\"Timestamp\":1000000000,\"Value\":1}]}\n" {
+			t.Errorf("%s: unexpected series response %v %q", name, w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", prefix+"/missing", nil))
+		var e errorResponse
+		if w.Code != 404 || json.Unmarshal(w.Body.Bytes(), &e) != nil || e.Status != 404 {
+			t.Errorf("%s: expected a JSON 404, got %v %q", name, w.Code, w.Body.String())
+		}
+
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", prefix+"/series", nil))
+		if w.Code != 405 || w.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s: expected a 405 allowing GET and HEAD, got %v %v", name, w.Code, w.Header())
+		}
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("HEAD", prefix+"/poll", nil))
+		if w.Code != 405 || w.Header().Get("Allow") != "GET" {
+			t.Errorf("%s: expected a 405 allowing GET for a streaming endpoint, got %v %v", name, w.Code, w.Header())
+		}
+	}
+
+	p.SetBaseURL("http://example.com/telemetry")
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "[{\"Name\":\"Test\",\"URL\":\"http://example.com/telemetry/series?q=Test\"}]\n" {
+		t.Errorf("Expected the base URL to override the derived one, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/series?q=Test&step=x", nil))
+	var e errorResponse
+	if w.Code != 400 || json.Unmarshal(w.Body.Bytes(), &e) != nil || e.Error == "" {
+		t.Errorf("Expected a JSON 400, got %v %q", w.Code, w.Body.String())
+	}
+}
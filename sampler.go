@@ -1,55 +1,52 @@
 package gotelem
 
 import (
+	"sync"
 	"time"
 )
 
+// A Sampler calls its callback every interval. Sampling is driven by
+// a Scheduler, the callback is called from the scheduler goroutine
+// for the interval. Stop, Start and SetInterval may be called from
+// any goroutine.
 type Sampler struct {
-	stop     chan bool
-	ticker   *time.Ticker
-	interval time.Duration
-	callback func(time.Time)
+	mu        sync.Mutex
+	scheduler *Scheduler
+	interval  time.Duration
+	callback  func(time.Time)
 }
 
+// Creates a sampler driven by the DefaultScheduler.
 func NewSampler(interval time.Duration, callback func(time.Time)) (sampler *Sampler) {
-	sampler = &Sampler{
-		stop:     make(chan bool),
-		callback: callback,
-		interval: interval}
-	sampler.SetInterval(interval)
-	return
+	return DefaultScheduler.NewSampler(interval, callback)
 }
 
-func (s *Sampler) Stop() {
-	if s.ticker != nil {
-		s.ticker.Stop()
-		s.stop <- true
-	}
+func (s *Sampler) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
 }
 
-func (s *Sampler) SetInterval(interval time.Duration) {
-	s.interval = interval
-	s.setSamplingTicker(time.NewTicker(interval))
+// Stops sampling until Start is called. Stopping a nil Sampler, like
+// the one of an instrument created without a sampling interval, does
+// nothing.
+func (s *Sampler) Stop() {
+	if s == nil {
+		return
+	}
+	s.scheduler.Unregister(s)
 }
 
-func (s *Sampler) setSamplingTicker(ticker *time.Ticker) {
+// Resumes sampling after Stop.
+func (s *Sampler) Start() {
 	s.Stop()
-	s.ticker = ticker
-	s.stop = make(chan bool)
-	go s.sampler(s.ticker.C, s.stop)
+	s.scheduler.Register(s)
 }
 
-func (s *Sampler) sampler(ticker <-chan time.Time, stop <-chan bool) {
-	for {
-		// ticker.Stop() doesn't close the channel because this could
-		// cause problems for users who do not check the return value
-		// of the receive. I guess it's a sensible tradeoff, my case
-		// of restarting the ticker is probably rare.
-		select {
-		case t := <-ticker:
-			s.callback(t)
-		case <-stop:
-			return
-		}
-	}
+func (s *Sampler) SetInterval(interval time.Duration) {
+	s.Stop()
+	s.mu.Lock()
+	s.interval = interval
+	s.mu.Unlock()
+	s.scheduler.Register(s)
 }
@@ -0,0 +1,128 @@
+package gotelem
+
+import (
+	"sync"
+	"time"
+)
+
+// The scheduler used by NewSampler and by factories without a
+// Scheduler of their own.
+var DefaultScheduler *Scheduler = NewScheduler()
+
+// A Scheduler drives the sampling of any number of samplers. Samplers
+// with the same interval are grouped together and sampled from a
+// single goroutine, so a few hundred observers sampled every second
+// cost one timer rather than a few hundred tickers.
+//
+// Sampling is aligned to the wall clock, i.e. samplers with a one
+// minute interval are sampled at the start of every minute. All the
+// samplers in a group are sampled with the same timestamp, one after
+// the other, so a slow callback delays the rest of its group.
+type Scheduler struct {
+	mu     sync.Mutex
+	clock  Clock
+	groups map[time.Duration]*samplerGroup
+}
+
+// The samplers sharing an interval. The samplers map is guarded by
+// the mutex of the Scheduler.
+type samplerGroup struct {
+	interval time.Duration
+	samplers map[*Sampler]bool
+	stop     chan bool
+}
+
+func NewScheduler() *Scheduler {
+	return NewSchedulerWithClock(SystemClock)
+}
+
+// Creates a scheduler which samples according to the given clock.
+func NewSchedulerWithClock(clock Clock) *Scheduler {
+	return &Scheduler{clock: clock, groups: make(map[time.Duration]*samplerGroup)}
+}
+
+// Creates a sampler which is driven by this scheduler.
+func (s *Scheduler) NewSampler(interval time.Duration, callback func(time.Time)) (sampler *Sampler) {
+	sampler = &Sampler{
+		scheduler: s,
+		callback:  callback,
+		interval:  interval}
+	s.Register(sampler)
+	return
+}
+
+// Starts sampling the sampler at its interval. Registering a sampler
+// which is already registered, or which has no interval, has no
+// effect.
+func (s *Scheduler) Register(sampler *Sampler) {
+	interval := sampler.Interval()
+	if interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[interval]
+	if g == nil {
+		g = &samplerGroup{
+			interval: interval,
+			samplers: make(map[*Sampler]bool),
+			stop:     make(chan bool)}
+		s.groups[interval] = g
+		go s.run(g)
+	}
+	g.samplers[sampler] = true
+}
+
+// Stops sampling the sampler. The goroutine of an interval is stopped
+// when its last sampler is unregistered.
+func (s *Scheduler) Unregister(sampler *Sampler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for interval, g := range s.groups {
+		if !g.samplers[sampler] {
+			continue
+		}
+		delete(g.samplers, sampler)
+		if len(g.samplers) == 0 {
+			close(g.stop)
+			delete(s.groups, interval)
+		}
+	}
+}
+
+// Returns the number of registered samplers.
+func (s *Scheduler) Len() (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, g := range s.groups {
+		n += len(g.samplers)
+	}
+	return
+}
+
+func (s *Scheduler) run(g *samplerGroup) {
+	for {
+		now := s.clock.Now()
+		next := now.Truncate(g.interval).Add(g.interval)
+		timer := s.clock.NewTimer(next.Sub(now))
+		select {
+		case <-timer.C():
+			for _, sampler := range s.snapshot(g) {
+				sampler.callback(next)
+			}
+		case <-g.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (s *Scheduler) snapshot(g *samplerGroup) []*Sampler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	samplers := make([]*Sampler, 0, len(g.samplers))
+	for sampler := range g.samplers {
+		samplers = append(samplers, sampler)
+	}
+	return samplers
+}
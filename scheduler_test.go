@@ -0,0 +1,68 @@
+package gotelem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler()
+	interval := 10 * time.Millisecond
+	ticks := make(chan time.Time, 100)
+	var samplers []*Sampler
+	for i := 0; i < 3; i++ {
+		samplers = append(samplers, s.NewSampler(interval, func(t time.Time) { ticks <- t }))
+	}
+	other := s.NewSampler(time.Hour, func(time.Time) {})
+	registered := time.Now()
+
+	s.mu.Lock()
+	groups := len(s.groups)
+	s.mu.Unlock()
+	if groups != 2 {
+		t.Errorf("Expected one group per interval, got %v", groups)
+	}
+	if s.Len() != 4 {
+		t.Errorf("Expected 4 registered samplers, got %v", s.Len())
+	}
+
+	// All three samplers are sampled with the same, aligned,
+	// timestamp. Skip ticks from before all samplers were registered.
+	first := <-ticks
+	for !first.After(registered) {
+		first = <-ticks
+	}
+	if !first.Truncate(interval).Equal(first) {
+		t.Errorf("Expected tick aligned to %v, got %v", interval, first)
+	}
+	for i := 0; i < 2; i++ {
+		if tick := <-ticks; !tick.Equal(first) {
+			t.Errorf("Expected all samplers in a group to get %v, got %v", first, tick)
+		}
+	}
+
+	for _, sampler := range samplers {
+		sampler.Stop()
+	}
+	other.Stop()
+	if s.Len() != 0 {
+		t.Errorf("Expected no registered samplers after Stop, got %v", s.Len())
+	}
+	s.mu.Lock()
+	groups = len(s.groups)
+	s.mu.Unlock()
+	if groups != 0 {
+		t.Errorf("Expected the groups to be removed, got %v", groups)
+	}
+
+	// Restarting puts the sampler back on the schedule
+	samplers[0].Start()
+	if s.Len() != 1 {
+		t.Errorf("Expected 1 registered sampler after Start, got %v", s.Len())
+	}
+	samplers[0].SetInterval(time.Hour)
+	if s.Len() != 1 || samplers[0].Interval() != time.Hour {
+		t.Errorf("SetInterval should move the sampler, got %v samplers and interval %v", s.Len(), samplers[0].Interval())
+	}
+	samplers[0].Stop()
+}
@@ -0,0 +1,158 @@
+package gotelem
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The series selected by the q, re and meta parameters of /series:
+//
+//	q     a series key, or a glob where * matches any run of
+//	      characters and ? a single character, e.g. q=BAPI_*:5M_*.
+//	      A key which exists is never treated as a glob.
+//	re    a regular expression matched against the series keys, e.g.
+//	      re=^BAPI_.*:5M_P9. Like grep it matches anywhere in the key
+//	      unless anchored.
+//	meta  when true the names of the selected series are returned,
+//	      grouped by base metric and window, instead of their points.
+//	      Without q or re every series is selected.
+type seriesSelection struct {
+	names []string
+	// The globs among the names, keyed by name.
+	globs    map[string]*regexp.Regexp
+	patterns []*regexp.Regexp
+	meta     bool
+}
+
+func parseSeriesSelection(params url.Values) (s *seriesSelection, err error) {
+	s = &seriesSelection{names: params["q"], globs: make(map[string]*regexp.Regexp)}
+	for _, name := range s.names {
+		if strings.ContainsAny(name, "*?") {
+			s.globs[name] = globRegexp(name)
+		}
+	}
+	for _, re := range params["re"] {
+		pattern, err := regexp.Compile(re)
+		if err != nil {
+			return nil, fmt.Errorf("invalid re: %v", err)
+		}
+		s.patterns = append(s.patterns, pattern)
+	}
+	if meta := params.Get("meta"); meta != "" {
+		if s.meta, err = strconv.ParseBool(meta); err != nil {
+			return nil, fmt.Errorf("invalid meta: %q", meta)
+		}
+	}
+	return s, nil
+}
+
+// Returns an anchored regular expression matching what the glob
+// matches.
+func globRegexp(glob string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// Returns the sorted keys of the selected series among the available
+// ones. A glob which is the key of a series selects just that series.
+func (s *seriesSelection) keys(available []string) (keys []string) {
+	all := s.meta && len(s.names) == 0 && len(s.patterns) == 0
+	stored := make(map[string]bool, len(available))
+	for _, key := range available {
+		stored[key] = true
+	}
+	exact := make(map[string]bool, len(s.names))
+	patterns := append([]*regexp.Regexp(nil), s.patterns...)
+	for _, name := range s.names {
+		if glob := s.globs[name]; glob != nil && !stored[name] {
+			patterns = append(patterns, glob)
+		} else {
+			exact[name] = true
+		}
+	}
+	for _, key := range available {
+		if all || exact[key] || matches(patterns, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return
+}
+
+func matches(patterns []*regexp.Regexp, key string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// A seriesGroup holds the names of the series of a metric, see
+// seriesMetric. Series holds those published by the instrument itself,
+// Windows the summaries keyed by their window.
+type seriesGroup struct {
+	Metric  string
+	Series  []string            `json:",omitempty"`
+	Windows map[string][]string `json:",omitempty"`
+}
+
+// Groups the series keys by metric and window, given the names of the
+// histograms. The keys are sorted, so are the groups and the names in
+// them.
+func groupSeries(keys []string, histograms map[string]bool) []*seriesGroup {
+	groups := make([]*seriesGroup, 0)
+	byMetric := make(map[string]*seriesGroup)
+	for _, key := range keys {
+		name := parseSeriesName(key)
+		metric := seriesMetric(name, histograms)
+		group := byMetric[metric]
+		if group == nil {
+			group = &seriesGroup{Metric: metric}
+			byMetric[metric] = group
+			groups = append(groups, group)
+		}
+		if name.statistic == "" {
+			group.Series = append(group.Series, key)
+			continue
+		}
+		if group.Windows == nil {
+			group.Windows = make(map[string][]string)
+		}
+		group.Windows[name.window] = append(group.Windows[name.window], key)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Metric < groups[j].Metric })
+	return groups
+}
+
+// Returns the metric of the series: the base and labels of its name,
+// except for the series of a histogram, like Size_bucket{le="1"} and
+// Size:1M_COUNT, which all belong to the histogram. Histograms have no
+// labels other than the le label of the buckets.
+func seriesMetric(name seriesName, histograms map[string]bool) string {
+	if histograms[name.base] {
+		return name.base
+	}
+	for _, part := range []string{"_bucket", "_sum", "_count"} {
+		if base := strings.TrimSuffix(name.base, part); base != name.base && histograms[base] {
+			return base
+		}
+	}
+	return name.metric()
+}
@@ -0,0 +1,94 @@
+package gotelem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesSelection(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	for _, name := range []string{"BAPI_Call", "BAPI_Call:1M_AVG", "BAPI_Call:5M_AVG", "BAPI_Call:5M_P99",
+		"BAPI_Exec:5M_MAX", "Other:5M_AVG", "Odd*", "OddBall"} {
+		p.Receive(&Observation{Timestamp: time.Unix(1, 0), Name: name, Value: 1})
+	}
+	p.setSeriesType("Size", "histogram")
+	for _, name := range []string{"Size_bucket", "Size_sum", "Size_count", "Size:1M_BUCKET", "Size:1M_COUNT"} {
+		var labels Labels
+		if strings.HasSuffix(name, "BUCKET") || strings.HasSuffix(name, "bucket") {
+			labels = Labels{"le": "1"}
+		}
+		p.Receive(&Observation{Timestamp: time.Unix(1, 0), Name: name, Value: 1, Labels: labels})
+	}
+	p.Flush()
+	get := func(query string) (code int, body []byte) {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/series?"+query, nil))
+		return w.Code, w.Body.Bytes()
+	}
+	selected := func(query string) (names []string) {
+		code, body := get(query)
+		var result map[string][]TimeSeriesPoint
+		if code != 200 || json.Unmarshal(body, &result) != nil {
+			t.Fatalf("Unexpected response to %v: %v %q", query, code, body)
+		}
+		for name := range result {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return
+	}
+
+	for query, expected := range map[string][]string{
+		"q=" + url.QueryEscape("BAPI_*:5M_*"):      {"BAPI_Call:5M_AVG", "BAPI_Call:5M_P99", "BAPI_Exec:5M_MAX"},
+		"q=" + url.QueryEscape("BAPI_Call:?M_AVG"): {"BAPI_Call:1M_AVG", "BAPI_Call:5M_AVG"},
+		"q=BAPI_Call&q=Other:5M_AVG":               {"BAPI_Call", "Other:5M_AVG"},
+		"re=" + url.QueryEscape("_AVG$"):           {"BAPI_Call:1M_AVG", "BAPI_Call:5M_AVG", "Other:5M_AVG"},
+		"re=Exec&q=Other:5M_AVG":                   {"BAPI_Exec:5M_MAX", "Other:5M_AVG"},
+		"q=" + url.QueryEscape("Odd*"):             {"Odd*"},
+		"q=" + url.QueryEscape("Odd?all"):          {"OddBall"},
+		"q=Missing":                                nil,
+	} {
+		if names := selected(query); !reflect.DeepEqual(names, expected) {
+			t.Errorf("Expected %v to select %v, got %v", query, expected, names)
+		}
+	}
+
+	if code, _ := get("re=" + url.QueryEscape("(")); code != 400 {
+		t.Errorf("Expected an invalid re to give 400, got %v", code)
+	}
+	if code, _ := get("meta=maybe"); code != 400 {
+		t.Errorf("Expected an invalid meta to give 400, got %v", code)
+	}
+
+	code, body := get("meta=true&q=BAPI_*")
+	var groups []*seriesGroup
+	if code != 200 || json.Unmarshal(body, &groups) != nil {
+		t.Fatalf("Unexpected metadata response %v %q", code, body)
+	}
+	expected := []*seriesGroup{
+		{Metric: "BAPI_Call", Series: []string{"BAPI_Call"}, Windows: map[string][]string{
+			"1M": {"BAPI_Call:1M_AVG"}, "5M": {"BAPI_Call:5M_AVG", "BAPI_Call:5M_P99"}}},
+		{Metric: "BAPI_Exec", Windows: map[string][]string{"5M": {"BAPI_Exec:5M_MAX"}}},
+	}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Unexpected metadata %s", body)
+	}
+	code, body = get("meta=true&q=Size*")
+	expected = []*seriesGroup{
+		{Metric: "Size", Series: []string{`Size_bucket{le="1"}`, "Size_count", "Size_sum"}, Windows: map[string][]string{
+			"1M": {`Size:1M_BUCKET{le="1"}`, "Size:1M_COUNT"}}},
+	}
+	groups = nil
+	if json.Unmarshal(body, &groups) != nil || !reflect.DeepEqual(groups, expected) {
+		t.Errorf("Expected the series of a histogram to be grouped under it, got %s", body)
+	}
+	if code, body = get("meta=1"); json.Unmarshal(body, &groups) != nil || len(groups) != 6 {
+		t.Errorf("Expected meta without a selection to group every series, got %s", body)
+	}
+}
@@ -0,0 +1,69 @@
+package gotelem
+
+import (
+	"time"
+)
+
+// The kinds of series, see SeriesInfo.
+const (
+	// The values given to the instrument, or sampled from it like the
+	// value of a gauge.
+	RawSeries = "raw"
+	// A cumulative count, like the count of a counter or the buckets
+	// of a histogram.
+	CountSeries = "count"
+	// The rate of a counter, per the RateUnit of the factory.
+	RateSeries = "rate"
+	// A statistic computed by a summarizer over a window.
+	SummarySeries = "summary"
+)
+
+// A SeriesInfo describes a published series: its kind, the name of
+// the instrument it comes from, and for summaries the statistic
+// and window, e.g. P99 and 5M. SamplingInterval is zero for series
+// published as the values are observed, like the raw series of an
+// Observer. Description is the one set on the instrument and so is
+// Unit, except that a rate is per the unit of the rate, e.g.
+// requests/sec, and that counts of observations, like the COUNT
+// statistic or the buckets of a histogram, have no unit.
+type SeriesInfo struct {
+	Kind             string
+	Instrument       string        `json:",omitempty"`
+	Statistic        string        `json:",omitempty"`
+	Window           string        `json:",omitempty"`
+	SamplingInterval time.Duration `json:",omitempty"`
+	Description      string        `json:",omitempty"`
+	Unit             string        `json:",omitempty"`
+}
+
+// Returns the unit of a series given the unit of its instrument.
+type seriesUnit func(unit string) string
+
+// The unit of the instrument.
+func sameUnit(unit string) string {
+	return unit
+}
+
+// No unit, for counts of observations.
+func noUnit(string) string {
+	return ""
+}
+
+// Returns the unit of a rate per rateUnit, e.g. requests/sec for the
+// unit requests and the rateUnit sec.
+func perUnit(rateUnit string) seriesUnit {
+	return func(unit string) string {
+		if unit == "" {
+			return ""
+		}
+		return unit + "/" + rateUnit
+	}
+}
+
+// Implemented by receivers which expose what the series are, like the
+// HTTPPublisher. DescribeSeries is called before the first observation
+// of a series is received, and again if the instrument's description
+// or unit changes.
+type SeriesDescriber interface {
+	DescribeSeries(key string, info *SeriesInfo)
+}
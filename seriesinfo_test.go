@@ -0,0 +1,105 @@
+package gotelem
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSeriesInfo(t *testing.T) {
+	tp := newTestPipeline(time.Minute)
+	p := tp.p
+	factory := tp.factory
+	factory.RateAverages = []time.Duration{time.Minute}
+	requests := factory.NewCounter("Requests")
+	defer requests.Stop()
+	requests.SetDescription("Requests served")
+	requests.SetUnit("requests")
+	latency := factory.NewDurationObserver("Latency", time.Millisecond)
+	defer latency.Stop()
+	size := factory.NewHistogram("Size", []float64{1})
+	defer size.Stop()
+	size.SetUnit("bytes")
+	tp.start()
+
+	requests.With("route", "/x").Inc()
+	latency.Observe(time.Second)
+	size.Observe(2)
+	tp.sample()
+
+	// Returns info with the kind, for summaries the statistic and
+	// window, and the unit set.
+	as := func(info SeriesInfo, kind, statistic, window, unit string) SeriesInfo {
+		info.Kind, info.Statistic, info.Window, info.Unit = kind, statistic, window, unit
+		return info
+	}
+	counter := SeriesInfo{Instrument: "Requests", SamplingInterval: time.Second, Description: "Requests served"}
+	timer := SeriesInfo{Instrument: "Latency", SamplingInterval: time.Second}
+	histogram := SeriesInfo{Instrument: "Size", SamplingInterval: time.Second}
+	expected := map[string]SeriesInfo{
+		"Requests":                  as(counter, CountSeries, "", "", "requests"),
+		`Requests/sec{route="/x"}`:  as(counter, RateSeries, "", "", "requests/sec"),
+		"Requests/sec:RATE_EWMA_1M": as(counter, SummarySeries, "RATE_EWMA", "1M", "requests/sec"),
+		"Requests:1M_AVG":           as(counter, SummarySeries, "AVG", "1M", "requests"),
+		"Latency_ms":                {Kind: RawSeries, Instrument: "Latency", Unit: "ms"},
+		"Latency_ms:1M_MAX":         as(timer, SummarySeries, "MAX", "1M", "ms"),
+		"Latency_ms:1M_COUNT":       as(timer, SummarySeries, "COUNT", "1M", ""),
+		`Size_bucket{le="1"}`:       as(histogram, CountSeries, "", "", ""),
+		"Size_sum":                  as(histogram, CountSeries, "", "", "bytes"),
+		"Size:1M_COUNT":             as(histogram, SummarySeries, "COUNT", "1M", ""),
+		"Size:1M_SUM":               as(histogram, SummarySeries, "SUM", "1M", "bytes"),
+	}
+	p.mu.RLock()
+	for key, info := range expected {
+		if got := p.infos[key]; got == nil || *got != info {
+			t.Errorf("Expected %v to be described as %+v, got %+v", key, info, got)
+		}
+	}
+	p.mu.RUnlock()
+
+	if info := requests.SeriesInfo("Requests:1M_AVG"); info == nil || *info != expected["Requests:1M_AVG"] {
+		t.Errorf("Unexpected SeriesInfo %+v", info)
+	}
+	if info := requests.SeriesInfo("Latency_ms"); info != nil {
+		t.Errorf("Expected no SeriesInfo for the series of another instrument, got %+v", info)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	var series []*timeseries
+	if err := json.Unmarshal(w.Body.Bytes(), &series); err != nil {
+		t.Fatalf("Invalid listing %q: %v", w.Body.String(), err)
+	}
+	for _, s := range series {
+		if s.Name == "Latency_ms:1M_MAX" && (s.SeriesInfo == nil || *s.SeriesInfo != expected[s.Name]) {
+			t.Errorf("Expected the listing to describe %v, got %+v", s.Name, s.SeriesInfo)
+		}
+	}
+
+	requests.SetDescription("Requests handled\nby the server")
+	w = httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if help := "# HELP Requests Requests handled\\nby the server (requests)\n"; !strings.Contains(w.Body.String(), help) {
+		t.Errorf("Expected %q in\n%s", help, w.Body.String())
+	}
+	for _, help := range []string{
+		"# HELP Latency_ms (ms)\n",
+		"# HELP Latency_ms_1M (ms)\n",
+		"# HELP Requests_per_sec Requests handled\\nby the server (requests/sec)\n",
+		"# HELP Size (bytes)\n",
+	} {
+		if !strings.Contains(w.Body.String(), help) {
+			t.Errorf("Expected %q in\n%s", help, w.Body.String())
+		}
+	}
+
+	late := NewHTTPPublisher(10)
+	requests.AddReceiver(late)
+	late.mu.RLock()
+	if info := late.infos["Requests"]; info == nil || info.Description != "Requests handled\nby the server" {
+		t.Errorf("Expected a receiver added later to be told about the series, got %+v", info)
+	}
+	late.mu.RUnlock()
+}
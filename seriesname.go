@@ -0,0 +1,50 @@
+package gotelem
+
+import (
+	"strings"
+)
+
+// A seriesName is a series key split into its parts. The key
+// Latency:1M_P99{route="/x"} has the base Latency, the window 1M, the
+// statistic P99 and the labels {route="/x"}. Series published by the
+// instruments themselves, like Latency, have no window or statistic.
+type seriesName struct {
+	base      string
+	window    string
+	statistic string
+	labels    string
+}
+
+// Splits a series key, see Observation.Key, into its parts. The
+// summaries are named WINDOW_STATISTIC, e.g. 5M_AVG or ALL_MAX, except
+// the moving averages which are named EWMA_WINDOW, or RATE_EWMA_WINDOW
+// for the averages of a rate.
+func parseSeriesName(key string) (n seriesName) {
+	name := key
+	if brace := strings.Index(key, "{"); brace >= 0 {
+		name, n.labels = key[:brace], key[brace:]
+	}
+	colon := strings.Index(name, ":")
+	if colon < 0 {
+		n.base = name
+		return
+	}
+	n.base = name[:colon]
+	summary := name[colon+1:]
+	if strings.HasPrefix(summary, "EWMA_") {
+		n.window, n.statistic = summary[len("EWMA_"):], "EWMA"
+	} else if strings.HasPrefix(summary, "RATE_EWMA_") {
+		n.window, n.statistic = summary[len("RATE_EWMA_"):], "RATE_EWMA"
+	} else if underscore := strings.LastIndex(summary, "_"); underscore >= 0 {
+		n.window, n.statistic = summary[:underscore], summary[underscore+1:]
+	} else {
+		n.statistic = summary
+	}
+	return
+}
+
+// Returns the key of the series the summary was made from, that is
+// the base and the labels.
+func (n seriesName) metric() string {
+	return n.base + n.labels
+}
@@ -0,0 +1,21 @@
+package gotelem
+
+import (
+	"testing"
+)
+
+func TestParseSeriesName(t *testing.T) {
+	for key, expected := range map[string]seriesName{
+		"Latency":                       {base: "Latency"},
+		"Latency:1M_P99":                {base: "Latency", window: "1M", statistic: "P99"},
+		"Latency:ALL_AVG{route=\"/x\"}": {base: "Latency", window: "ALL", statistic: "AVG", labels: "{route=\"/x\"}"},
+		"Calls/sec:EWMA_5M":             {base: "Calls/sec", window: "5M", statistic: "EWMA"},
+		"Calls/sec:EWMA_A0.5":           {base: "Calls/sec", window: "A0.5", statistic: "EWMA"},
+		"Calls/sec:RATE_EWMA_15M":       {base: "Calls/sec", window: "15M", statistic: "RATE_EWMA"},
+		"Size:1M_BUCKET{le=\"1:2\"}":    {base: "Size", window: "1M", statistic: "BUCKET", labels: "{le=\"1:2\"}"},
+	} {
+		if name := parseSeriesName(key); name != expected {
+			t.Errorf("Expected %v to parse as %+v, got %+v", key, expected, name)
+		}
+	}
+}
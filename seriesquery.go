@@ -0,0 +1,127 @@
+package gotelem
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The selection of points made by the from, to, step and agg
+// parameters of /series:
+//
+//	from, to  only points with from <= timestamp < to are returned.
+//	          Either a timestamp in nanoseconds since the epoch, like
+//	          the timestamps of the points, or RFC 3339.
+//	step      the points are downsampled to one point per step, e.g.
+//	          step=1m. The steps are aligned to the epoch and each
+//	          point has the timestamp of the start of its step.
+//	agg       how the values of a step are aggregated: avg (the
+//	          default), min, max or last.
+type seriesQuery struct {
+	from      time.Time
+	to        time.Time
+	step      time.Duration
+	aggregate func(values []float64) float64
+}
+
+var aggregates = map[string]func(values []float64) float64{
+	"avg": func(values []float64) float64 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		return sum / float64(len(values))
+	},
+	"min": func(values []float64) float64 {
+		min := math.Inf(1)
+		for _, v := range values {
+			min = math.Min(min, v)
+		}
+		return min
+	},
+	"max": func(values []float64) float64 {
+		max := math.Inf(-1)
+		for _, v := range values {
+			max = math.Max(max, v)
+		}
+		return max
+	},
+	"last": func(values []float64) float64 {
+		return values[len(values)-1]
+	},
+}
+
+func parseSeriesQuery(params url.Values) (q *seriesQuery, err error) {
+	q = &seriesQuery{aggregate: aggregates["avg"]}
+	if q.from, err = parseTimestamp(params.Get("from")); err != nil {
+		return nil, fmt.Errorf("invalid from: %v", err)
+	}
+	if q.to, err = parseTimestamp(params.Get("to")); err != nil {
+		return nil, fmt.Errorf("invalid to: %v", err)
+	}
+	if step := params.Get("step"); step != "" {
+		if q.step, err = time.ParseDuration(step); err != nil || q.step <= 0 {
+			return nil, fmt.Errorf("invalid step: %q", step)
+		}
+	}
+	if agg := params.Get("agg"); agg != "" {
+		if q.aggregate = aggregates[agg]; q.aggregate == nil {
+			return nil, fmt.Errorf("invalid agg: %q, expected avg, min, max or last", agg)
+		}
+	}
+	return q, nil
+}
+
+// Parses nanoseconds since the epoch or an RFC 3339 timestamp. The
+// empty string gives the zero time.
+func parseTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if ns, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(0, ns), nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// Returns the points of the observations selected by the query. The
+// observations are in timestamp order.
+func (q *seriesQuery) points(observations []*Observation) []TimeSeriesPoint {
+	points := make([]TimeSeriesPoint, 0, len(observations))
+	var start int64
+	var values []float64
+	for _, o := range observations {
+		if (!q.from.IsZero() && o.Timestamp.Before(q.from)) || (!q.to.IsZero() && !o.Timestamp.Before(q.to)) {
+			continue
+		}
+		if q.step == 0 {
+			points = append(points, TimeSeriesPoint{o.Timestamp.UnixNano(), o.Value})
+			continue
+		}
+		if s := q.stepStart(o.Timestamp); s != start {
+			if len(values) > 0 {
+				points = append(points, TimeSeriesPoint{start, q.aggregate(values)})
+			}
+			start, values = s, values[:0]
+		}
+		values = append(values, o.Value)
+	}
+	if len(values) > 0 {
+		points = append(points, TimeSeriesPoint{start, q.aggregate(values)})
+	}
+	return points
+}
+
+// Returns the start of the step the timestamp is in, in nanoseconds
+// since the epoch. Unlike time.Time.Truncate, which aligns to the zero
+// time, the steps are aligned to the epoch.
+func (q *seriesQuery) stepStart(t time.Time) int64 {
+	ns := t.UnixNano()
+	offset := ns % int64(q.step)
+	if offset < 0 {
+		offset += int64(q.step)
+	}
+	return ns - offset
+}
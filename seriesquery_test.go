@@ -0,0 +1,81 @@
+package gotelem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSeriesQuery(t *testing.T) {
+	p := NewHTTPPublisher(100)
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		p.Receive(&Observation{Timestamp: ts.Add(time.Duration(i) * 10 * time.Second), Name: "Test", Value: float64(i)})
+	}
+	p.Flush()
+	get := func(query string) (code int, points []TimeSeriesPoint) {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/series?q=Test&"+query, nil))
+		if w.Code != http.StatusOK {
+			return w.Code, nil
+		}
+		var result map[string][]TimeSeriesPoint
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+		}
+		return w.Code, result["Test"]
+	}
+	values := func(points []TimeSeriesPoint) (values []float64) {
+		for _, p := range points {
+			values = append(values, p.Value)
+		}
+		return
+	}
+	equal := func(a, b []float64) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	if _, points := get(""); len(points) != 10 {
+		t.Errorf("Expected all the points without parameters, got %v", points)
+	}
+	from := strconv.FormatInt(ts.Add(20*time.Second).UnixNano(), 10)
+	to := ts.Add(60 * time.Second).Format(time.RFC3339)
+	if _, points := get("from=" + from + "&to=" + to); !equal(values(points), []float64{2, 3, 4, 5}) {
+		t.Errorf("Expected the points in [from, to), got %v", points)
+	}
+	for agg, expected := range map[string][]float64{
+		"":         {1, 4, 7, 9},
+		"agg=avg":  {1, 4, 7, 9},
+		"agg=min":  {0, 3, 6, 9},
+		"agg=max":  {2, 5, 8, 9},
+		"agg=last": {2, 5, 8, 9},
+	} {
+		_, points := get("step=30s&" + agg)
+		if !equal(values(points), expected) {
+			t.Errorf("Expected %v with %q, got %v", expected, agg, points)
+		}
+		if len(points) == 4 && points[1].Timestamp != ts.Add(30*time.Second).UnixNano() {
+			t.Errorf("Expected the points to have the timestamp of the start of the step")
+		}
+	}
+	// The zero time is not a multiple of 7s from the epoch.
+	if _, points := get("step=7s"); len(points) == 0 || points[0].Timestamp%int64(7*time.Second) != 0 {
+		t.Errorf("Expected the steps to be aligned to the epoch, got %v", points)
+	}
+	for _, invalid := range []string{"from=yesterday", "step=-1s", "step=often", "agg=median"} {
+		if code, _ := get(invalid); code != http.StatusBadRequest {
+			t.Errorf("Expected %q to be a bad request, got %v", invalid, code)
+		}
+	}
+}
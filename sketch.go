@@ -0,0 +1,132 @@
+package gotelem
+
+import (
+	"math"
+	"sort"
+)
+
+// Values closer to zero than this are counted in the zero bin of the
+// sketch.
+const sketchMinValue = 1e-9
+
+// A ddSketch is a quantile sketch after the DDSketch paper (Masson,
+// Rim and Lee, 2019). Values are counted in logarithmically sized
+// bins, which makes the estimated quantiles accurate to within the
+// relative accuracy the sketch was created with. Sketches with the
+// same accuracy can be merged by adding the bin counts.
+//
+// If the number of bins grows beyond maxBins the lowest bins are
+// collapsed into one, sacrificing the accuracy of the smallest values
+// to bound the memory use.
+//
+// The implementation is *not* thread-safe.
+type ddSketch struct {
+	gamma    float64
+	logGamma float64
+	maxBins  int
+	positive map[int]uint64
+	negative map[int]uint64
+	zero     uint64
+	count    uint64
+}
+
+func newDDSketch(relativeAccuracy float64, maxBins int) *ddSketch {
+	gamma := (1 + relativeAccuracy) / (1 - relativeAccuracy)
+	return &ddSketch{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		maxBins:  maxBins,
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64)}
+}
+
+// The bin index of a positive value.
+func (s *ddSketch) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / s.logGamma))
+}
+
+// The value representing a bin, chosen so that every value in the bin
+// is within the relative accuracy of it.
+func (s *ddSketch) value(index int) float64 {
+	return 2 * math.Pow(s.gamma, float64(index)) / (s.gamma + 1)
+}
+
+func (s *ddSketch) add(v float64) {
+	switch {
+	case v > sketchMinValue:
+		s.positive[s.index(v)]++
+		s.collapse(s.positive)
+	case v < -sketchMinValue:
+		s.negative[s.index(-v)]++
+		s.collapse(s.negative)
+	default:
+		s.zero++
+	}
+	s.count++
+}
+
+// Adds the counts of another sketch, which must have been created
+// with the same relative accuracy.
+func (s *ddSketch) merge(other *ddSketch) {
+	for i, c := range other.positive {
+		s.positive[i] += c
+	}
+	for i, c := range other.negative {
+		s.negative[i] += c
+	}
+	s.collapse(s.positive)
+	s.collapse(s.negative)
+	s.zero += other.zero
+	s.count += other.count
+}
+
+// Merges the lowest bins until there are at most maxBins left.
+func (s *ddSketch) collapse(bins map[int]uint64) {
+	if s.maxBins <= 0 || len(bins) <= s.maxBins {
+		return
+	}
+	indexes := sortedBinIndexes(bins)
+	excess := len(indexes) - s.maxBins
+	target := indexes[excess]
+	for _, i := range indexes[:excess] {
+		bins[target] += bins[i]
+		delete(bins, i)
+	}
+}
+
+func sortedBinIndexes(bins map[int]uint64) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// Returns the estimated q quantile, or NaN if the sketch is empty.
+func (s *ddSketch) quantile(q float64) float64 {
+	if s.count == 0 {
+		return math.NaN()
+	}
+	rank := uint64(q * float64(s.count-1))
+	var seen uint64
+	// Negative values in increasing order means decreasing bin index.
+	negatives := sortedBinIndexes(s.negative)
+	for j := len(negatives) - 1; j >= 0; j-- {
+		seen += s.negative[negatives[j]]
+		if seen > rank {
+			return -s.value(negatives[j])
+		}
+	}
+	seen += s.zero
+	if seen > rank {
+		return 0
+	}
+	for _, i := range sortedBinIndexes(s.positive) {
+		seen += s.positive[i]
+		if seen > rank {
+			return s.value(i)
+		}
+	}
+	return math.NaN()
+}
@@ -0,0 +1,86 @@
+package gotelem
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDDSketchAccuracy(t *testing.T) {
+	r := rand.New(rand.NewSource(1337))
+	a := newDDSketch(0.01, sketchMaxBins)
+	b := newDDSketch(0.01, sketchMaxBins)
+	values := make([]float64, 0, 20000)
+	for i := 0; i < 20000; i++ {
+		v := r.ExpFloat64() * 100
+		if i%10 == 0 {
+			v = -v
+		}
+		values = append(values, v)
+		// Split the values over two sketches to exercise merge
+		if i%2 == 0 {
+			a.add(v)
+		} else {
+			b.add(v)
+		}
+	}
+	a.merge(b)
+	sort.Float64s(values)
+	for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99} {
+		exact := values[int(q*float64(len(values)-1))]
+		estimate := a.quantile(q)
+		if math.Abs(estimate-exact) > 0.01*math.Abs(exact)+1e-9 {
+			t.Errorf("Quantile %v: estimate %v not within 1%% of %v", q, estimate, exact)
+		}
+	}
+}
+
+func TestDDSketchCollapse(t *testing.T) {
+	s := newDDSketch(0.01, 10)
+	for v := 1.0; v < 1e6; v *= 1.5 {
+		s.add(v)
+	}
+	if len(s.positive) > 10 {
+		t.Errorf("Expected at most 10 bins, got %v", len(s.positive))
+	}
+	// The highest quantiles are unaffected by collapsing the lowest bins
+	if max := s.quantile(1); max < 0.99*656840 {
+		t.Errorf("Expected max close to 656840, got %v", max)
+	}
+}
+
+func TestSketchSummarizer(t *testing.T) {
+	start := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	now := start
+	s := NewSketchSummarizer("Test", time.Minute, 6, 0.01, 0.5)
+	s.timeNow = func() time.Time { return now }
+	// One observation per second for two minutes
+	for i := 0; i < 120; i++ {
+		now = start.Add(time.Duration(i) * time.Second)
+		s.Update(&Observation{Timestamp: now, Name: "Test", Value: float64(i)})
+	}
+	if len(s.buckets) > 7 {
+		t.Errorf("Expected at most 7 buckets, got %v", len(s.buckets))
+	}
+	values := summaryValues(s.Summarize())
+	// Buckets expire as a whole, so the bucket holding 50..59 is kept
+	// since it is partially inside the window.
+	if values["Test:1M_COUNT"] != 70 {
+		t.Errorf("Expected COUNT=70, got %v", values["Test:1M_COUNT"])
+	}
+	if values["Test:1M_MIN"] != 50 || values["Test:1M_MAX"] != 119 {
+		t.Errorf("Expected MIN=50 and MAX=119, got %v and %v", values["Test:1M_MIN"], values["Test:1M_MAX"])
+	}
+	if p50 := values["Test:1M_P50"]; math.Abs(p50-84.5) > 0.01*84.5+1 {
+		t.Errorf("Expected P50 close to 84.5, got %v", p50)
+	}
+
+	// Nothing is left in the window once all buckets have expired
+	now = now.Add(2 * time.Minute)
+	values = summaryValues(s.Summarize())
+	if values["Test:1M_COUNT"] != 0 || !math.IsNaN(values["Test:1M_AVG"]) {
+		t.Errorf("Expected an empty window, got %v", values)
+	}
+}
@@ -0,0 +1,180 @@
+package gotelem
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of buckets the window of a SketchSummarizer is split
+	// into when created through SketchSummarizers.
+	DefaultSketchBuckets = 30
+	// Relative accuracy of the quantiles of a SketchSummarizer when
+	// created through SketchSummarizers.
+	DefaultSketchAccuracy = 0.01
+	// Maximum number of bins kept per sketch. With 1% accuracy this
+	// covers values spanning more than 8 orders of magnitude.
+	sketchMaxBins = 1024
+)
+
+// The SketchSummarizer publishes the same summaries as the
+// SlidingWindowSummarizer, but instead of keeping every observation in
+// the window it aggregates the observations into time buckets. Each
+// bucket keeps the count/sum/min/max of its observations along with a
+// quantile sketch, and the summaries are made by merging the buckets
+// that are still in the window. The memory used is bounded by the
+// number of buckets rather than the rate of observations, which makes
+// it the better choice for long windows on busy observers.
+//
+// The price is granularity: observations expire a whole bucket at a
+// time, and the quantiles are estimates accurate to within the given
+// relative accuracy.
+type SketchSummarizer struct {
+	mu          sync.Mutex
+	name        string
+	suffix      string
+	maxAge      time.Duration
+	bucketWidth time.Duration
+	accuracy    float64
+	quantiles   []float64
+	buckets     []*sketchBucket
+	timeNow     func() time.Time
+}
+
+// Observations with timestamps in [start, start+bucketWidth).
+type sketchBucket struct {
+	start  time.Time
+	count  int64
+	sum    float64
+	min    float64
+	max    float64
+	sketch *ddSketch
+}
+
+// Returns a SummarizerMaker for sketch summarizers over maxAge with
+// the default number of buckets and accuracy.
+func SketchSummarizers(maxAge time.Duration, quantiles ...float64) SummarizerMaker {
+	checkQuantiles("SketchSummarizers", quantiles)
+	return func(name string) Summarizer {
+		return NewSketchSummarizer(name, maxAge, DefaultSketchBuckets, DefaultSketchAccuracy, quantiles...)
+	}
+}
+
+// Creates a summarizer over a window of maxAge split into the given
+// number of buckets. The quantiles are estimated with the given
+// relative accuracy, e.g. 0.01 for 1%.
+func NewSketchSummarizer(name string, maxAge time.Duration, buckets int, relativeAccuracy float64, quantiles ...float64) *SketchSummarizer {
+	checkQuantiles("NewSketchSummarizer", quantiles)
+	if buckets < 1 {
+		buckets = 1
+	}
+	return &SketchSummarizer{
+		name:        name,
+		suffix:      suffix(maxAge),
+		maxAge:      maxAge,
+		bucketWidth: maxAge / time.Duration(buckets),
+		accuracy:    relativeAccuracy,
+		quantiles:   quantiles,
+		timeNow:     time.Now}
+}
+
+func (s *SketchSummarizer) Update(o *Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := s.bucket(o.Timestamp.Truncate(s.bucketWidth))
+	b.count++
+	b.sum += o.Value
+	if o.Value < b.min {
+		b.min = o.Value
+	}
+	if o.Value > b.max {
+		b.max = o.Value
+	}
+	b.sketch.add(o.Value)
+	s.expire()
+}
+
+// Finds or creates the bucket starting at start. The buckets are
+// sorted by start time and observations generally arrive in order, so
+// we search from the newest bucket.
+func (s *SketchSummarizer) bucket(start time.Time) *sketchBucket {
+	i := len(s.buckets)
+	for ; i > 0 && !s.buckets[i-1].start.Before(start); i-- {
+		if s.buckets[i-1].start.Equal(start) {
+			return s.buckets[i-1]
+		}
+	}
+	b := &sketchBucket{
+		start:  start,
+		min:    math.MaxFloat64,
+		max:    -math.MaxFloat64,
+		sketch: newDDSketch(s.accuracy, sketchMaxBins)}
+	s.buckets = append(s.buckets, nil)
+	copy(s.buckets[i+1:], s.buckets[i:])
+	s.buckets[i] = b
+	return b
+}
+
+// Drops the buckets which are entirely older than maxAge.
+func (s *SketchSummarizer) expire() {
+	oldestAcceptable := s.timeNow().Add(-s.maxAge)
+	expired := 0
+	for expired < len(s.buckets) && !s.buckets[expired].start.Add(s.bucketWidth).After(oldestAcceptable) {
+		expired++
+	}
+	if expired > 0 {
+		s.buckets = append(s.buckets[:0], s.buckets[expired:]...)
+	}
+}
+
+func (s *SketchSummarizer) Summarize() []*Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+	now := s.timeNow().UTC()
+	var count int64
+	sum := 0.0
+	min := math.MaxFloat64
+	max := -math.MaxFloat64
+	merged := newDDSketch(s.accuracy, sketchMaxBins)
+	for _, b := range s.buckets {
+		count += b.count
+		sum += b.sum
+		min = math.Min(min, b.min)
+		max = math.Max(max, b.max)
+		merged.merge(b.sketch)
+	}
+	avg := math.NaN()
+	if count != 0 {
+		avg = sum / float64(count)
+	}
+	summaries := []*Observation{
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_MIN", Value: min},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_MAX", Value: max},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_SUM", Value: sum},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_AVG", Value: avg},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_COUNT", Value: float64(count)}}
+	for _, q := range s.quantiles {
+		// The sketch estimates can fall slightly outside the observed
+		// range, clamp them so that e.g. P100 equals MAX.
+		v := merged.quantile(q)
+		if count != 0 {
+			v = math.Max(min, math.Min(max, v))
+		}
+		summaries = append(summaries, &Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_" + quantileSuffix(q), Value: v})
+	}
+	return summaries
+}
+
+func (s *SketchSummarizer) setClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeNow = c.Now
+}
+
+func (s *SketchSummarizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buckets = nil
+}
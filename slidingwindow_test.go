@@ -10,7 +10,7 @@ func TestSmokeTestSlidingWindow(t *testing.T) {
 	if len(w.items) != 0 {
 		t.Errorf("Window should be empty when nothing has been inserted")
 	}
-	expired := w.Add(&Observation{time.Now().UTC(), "Test", float64(42)})
+	expired := w.Add(&Observation{Timestamp: time.Now().UTC(), Name: "Test", Value: float64(42)})
 	if len(expired) != 0 {
 		t.Errorf("No expired items should be returned from empty window")
 	}
@@ -18,7 +18,7 @@ func TestSmokeTestSlidingWindow(t *testing.T) {
 	// Now make sure the first items expires
 	time.Sleep(2 * time.Millisecond)
 
-	expired = w.Add(&Observation{time.Now().UTC(), "Test", float64(84)})
+	expired = w.Add(&Observation{Timestamp: time.Now().UTC(), Name: "Test", Value: float64(84)})
 	if len(expired) != 1 {
 		t.Errorf("Add should return one expired item")
 	} else {
@@ -0,0 +1,271 @@
+package gotelem
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// The number of points buffered for each client of the streaming
+	// endpoints. Points for a client which falls further behind are
+	// dropped.
+	streamBufferSize = 1024
+	// How often a comment is sent on an idle event stream, to keep
+	// proxies from closing it.
+	streamKeepAlive = 15 * time.Second
+	// How long a long-poll waits for points by default, and at most.
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 5 * time.Minute
+	// Passed as since to get no stored points, only new ones.
+	sinceNow = math.MaxUint64
+)
+
+// A point of a series as sent by the streaming endpoints. Seq is the
+// sequence number of the point, which orders all the points of a
+// publisher, and is what the since cursor refers to. Values which JSON
+// cannot represent, like NaN, are sent as null.
+type StreamPoint struct {
+	Seq       uint64
+	Name      string
+	Timestamp int64
+	Value     float64
+}
+
+func (p *StreamPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Seq       uint64
+		Name      string
+		Timestamp int64
+		Value     interface{}
+	}{p.Seq, p.Name, p.Timestamp, jsonValue(p.Value)})
+}
+
+// A client of /stream or /poll waiting for points of the selected
+// series. The points are sent to it by processObservation as they
+// arrive.
+type subscriber struct {
+	// Updated atomically.
+	dropped int64
+	keys    map[string]bool
+	points  chan *StreamPoint
+}
+
+// The response to /poll. Dropped is the number of points which were
+// dropped, see RespondStream.
+type pollResponse struct {
+	Cursor  uint64
+	Points  []*StreamPoint
+	Dropped int64
+}
+
+// Streams the points of the series selected by the q parameters as
+// Server-Sent Events, as they are received. Each point is sent as an
+// event with the sequence number of the point as id and the point as
+// JSON data. If some points had to be dropped because the client did
+// not keep up, a dropped event with the number of points dropped is
+// sent.
+//
+// The stored points after a since parameter, or the Last-Event-ID
+// header of a reconnecting client, are sent first. If the cursor is
+// older than the stored points of a series, a dropped event is sent
+// before them. The number counts the points between the cursor and the
+// oldest stored point, which may include points of other series
+// published in between.
+func (h *HTTPPublisher) RespondStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	since := r.URL.Query().Get("since")
+	if id := r.Header.Get("Last-Event-ID"); id != "" {
+		since = id
+	}
+	cursor, err := parseSince(since)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s, backlog, _ := h.subscribe(r.URL.Query()["q"], cursor)
+	defer h.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if writeDropped(w, s) != nil {
+		return
+	}
+	for _, p := range backlog {
+		if writeEvent(w, p) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		var err error
+		select {
+		case p := <-s.points:
+			if err = writeDropped(w, s); err == nil {
+				err = writeEvent(w, p)
+			}
+		case <-keepAlive.C:
+			_, err = fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// Sends a dropped event if points were dropped since the previous one.
+func writeDropped(w http.ResponseWriter, s *subscriber) (err error) {
+	if dropped := atomic.SwapInt64(&s.dropped, 0); dropped > 0 {
+		_, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+	}
+	return
+}
+
+func writeEvent(w http.ResponseWriter, p *StreamPoint) error {
+	data, err := json.Marshal(p)
+	if err == nil {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", p.Seq, data)
+	}
+	return err
+}
+
+// Responds with the points of the series selected by the q parameters
+// which arrived after the since cursor, along with the cursor to pass
+// as since in the next poll. If there are no such points the request
+// waits for one to arrive, or for the timeout parameter to pass (30s
+// by default). Without since only points arriving from now on are
+// returned. Points which are no longer stored or which arrived faster
+// than they could be buffered are counted as dropped, see
+// RespondStream.
+func (h *HTTPPublisher) RespondPoll(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	since, err := parseSince(params.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeout := defaultPollTimeout
+	if t := params.Get("timeout"); t != "" {
+		if timeout, err = time.ParseDuration(t); err != nil || timeout < 0 {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid timeout: %q", t))
+			return
+		}
+		if timeout > maxPollTimeout {
+			timeout = maxPollTimeout
+		}
+	}
+	s, points, cursor := h.subscribe(params["q"], since)
+	defer h.unsubscribe(s)
+	if len(points) == 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case p := <-s.points:
+			points = append(points, p)
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+	// Take whatever else has arrived, typically the rest of a round
+	// of samples.
+	for drained := false; !drained; {
+		select {
+		case p := <-s.points:
+			points = append(points, p)
+		default:
+			drained = true
+		}
+	}
+	if len(points) > 0 && points[len(points)-1].Seq > cursor {
+		cursor = points[len(points)-1].Seq
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(&pollResponse{cursor, points, atomic.SwapInt64(&s.dropped, 0)})
+}
+
+// Parses a since cursor. The empty string gives sinceNow.
+func parseSince(since string) (uint64, error) {
+	if since == "" {
+		return sinceNow, nil
+	}
+	seq, err := strconv.ParseUint(since, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid since: %q", since)
+	}
+	return seq, nil
+}
+
+// Adds a subscriber for the series with the given keys. Returns it
+// along with the stored points of the series after since, in sequence
+// order, and the sequence number of the latest point. Points after
+// since which are no longer stored are counted as dropped by the
+// subscriber. Subscribing and collecting the stored points is done at
+// once, so that no point is missed or sent twice.
+func (h *HTTPPublisher) subscribe(keys []string, since uint64) (s *subscriber, backlog []*StreamPoint, seq uint64) {
+	s = &subscriber{keys: make(map[string]bool), points: make(chan *StreamPoint, streamBufferSize)}
+	for _, key := range keys {
+		s.keys[key] = true
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.subscribers[s] = true
+	if since != sinceNow {
+		for key := range s.keys {
+			if rb := h.series[key]; rb != nil {
+				atomic.AddInt64(&s.dropped, int64(rb.evictedSince(since)))
+				observations, seqs := rb.since(since)
+				for i, o := range observations {
+					backlog = append(backlog, newStreamPoint(key, o, seqs[i]))
+				}
+			}
+		}
+		sort.Slice(backlog, func(i, j int) bool { return backlog[i].Seq < backlog[j].Seq })
+	}
+	return s, backlog, h.seq
+}
+
+func (h *HTTPPublisher) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	delete(h.subscribers, s)
+	h.mu.Unlock()
+}
+
+// Sends the observation to the subscribers of its series. Called with
+// the lock held, so it must not block: points for subscribers with a
+// full buffer are dropped.
+func (h *HTTPPublisher) notify(key string, o *Observation, seq uint64) {
+	var p *StreamPoint
+	for s := range h.subscribers {
+		if !s.keys[key] {
+			continue
+		}
+		if p == nil {
+			p = newStreamPoint(key, o, seq)
+		}
+		select {
+		case s.points <- p:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	}
+}
+
+func newStreamPoint(key string, o *Observation, seq uint64) *StreamPoint {
+	return &StreamPoint{seq, key, o.Timestamp.UnixNano(), o.Value}
+}
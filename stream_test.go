@@ -0,0 +1,168 @@
+package gotelem
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Waits until the publisher has the given number of subscribers.
+func waitForSubscribers(t *testing.T, p *HTTPPublisher, n int) {
+	for i := 0; i < 1000; i++ {
+		p.mu.RLock()
+		subscribers := len(p.subscribers)
+		p.mu.RUnlock()
+		if subscribers == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %v subscribers", n)
+}
+
+func TestStream(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	server := httptest.NewServer(p)
+	defer server.Close()
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	p.Receive(&Observation{Timestamp: ts, Name: "A", Value: 1})
+	p.Receive(&Observation{Timestamp: ts, Name: "B", Value: 2})
+	p.Flush()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/stream?q=A&since=0", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if contentType := resp.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Errorf("Unexpected content type %v", contentType)
+	}
+	waitForSubscribers(t, p, 1)
+	p.Receive(&Observation{Timestamp: ts.Add(time.Second), Name: "B", Value: 3})
+	p.Receive(&Observation{Timestamp: ts.Add(time.Second), Name: "A", Value: math.NaN()})
+
+	lines := bufio.NewScanner(resp.Body)
+	var events []string
+	for len(events) < 4 && lines.Scan() {
+		if line := lines.Text(); strings.HasPrefix(line, "id:") || strings.HasPrefix(line, "data:") {
+			events = append(events, line)
+		}
+	}
+	expected := []string{
+		"id: 1",
+		`data: {"Seq":1,"Name":"A","Timestamp":` + strconv.FormatInt(ts.UnixNano(), 10) + `,"Value":1}`,
+		"id: 4",
+		`data: {"Seq":4,"Name":"A","Timestamp":` + strconv.FormatInt(ts.Add(time.Second).UnixNano(), 10) + `,"Value":null}`,
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the events\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+
+	cancel()
+	waitForSubscribers(t, p, 0)
+}
+
+func TestPoll(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	poll := func(query string) (code int, response *pollResponse) {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/poll?q=A&q=B&"+query, nil))
+		response = &pollResponse{}
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+				t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+			}
+		}
+		return w.Code, response
+	}
+	for i := 0; i < 3; i++ {
+		p.Receive(&Observation{Timestamp: ts, Name: "A", Value: float64(i)})
+		p.Receive(&Observation{Timestamp: ts, Name: "C", Value: float64(i)})
+	}
+	p.Flush()
+
+	_, response := poll("since=2")
+	if response.Cursor != 6 || len(response.Points) != 2 || response.Points[0].Seq != 3 || response.Points[1].Value != 2 {
+		t.Errorf("Expected the stored points after the cursor, got %+v", response)
+	}
+	_, response = poll("timeout=1ms")
+	if response.Cursor != 6 || len(response.Points) != 0 {
+		t.Errorf("Expected no points without since, got %+v", response)
+	}
+
+	done := make(chan *pollResponse)
+	go func() {
+		_, response := poll("since=6")
+		done <- response
+	}()
+	waitForSubscribers(t, p, 1)
+	p.Receive(&Observation{Timestamp: ts, Name: "B", Value: 42})
+	response = <-done
+	if response.Cursor != 7 || len(response.Points) != 1 || response.Points[0].Name != "B" {
+		t.Errorf("Expected the poll to wait for the new point, got %+v", response)
+	}
+	waitForSubscribers(t, p, 0)
+
+	if code, _ := poll("since=soon"); code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid since to be a bad request, got %v", code)
+	}
+}
+
+func TestStaleCursor(t *testing.T) {
+	p := NewHTTPPublisher(10)
+	server := httptest.NewServer(p)
+	defer server.Close()
+	ts := time.Date(1978, 2, 12, 16, 0, 0, 0, time.UTC)
+	// B gets the sequence numbers 1 to 5 and A 6 to 35, of which 6 to
+	// 25 are discarded.
+	for i := 0; i < 35; i++ {
+		name := "A"
+		if i < 5 {
+			name = "B"
+		}
+		p.Receive(&Observation{Timestamp: ts, Name: name, Value: float64(i)})
+	}
+	p.Flush()
+
+	for since, dropped := range map[string]int64{"2": 20, "20": 5, "25": 0} {
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, httptest.NewRequest("GET", "/poll?q=A&timeout=1ms&since="+since, nil))
+		var response pollResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Invalid response %q: %v", w.Body.String(), err)
+		}
+		if response.Dropped != dropped || len(response.Points) != 10 {
+			t.Errorf("Expected %v points after %v to be dropped, got %+v", dropped, since, response)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequest("GET", server.URL+"/stream?q=A&since=0", nil)
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	lines := bufio.NewScanner(resp.Body)
+	var events []string
+	for len(events) < 3 && lines.Scan() {
+		if line := lines.Text(); line != "" {
+			events = append(events, line)
+		}
+	}
+	if strings.Join(events, "\n") != "event: dropped\ndata: 20\nid: 26" {
+		t.Errorf("Expected a dropped event before the stored points, got\n%v", strings.Join(events, "\n"))
+	}
+}
@@ -3,14 +3,87 @@ package gotelem
 import (
 	"fmt"
 	"math"
+	"sync"
 	"time"
 )
 
+// A Summarizer derives summary series from the observations of a
+// single series. Update is called with each observation and Summarize
+// every time the instrument is sampled. Update and Summarize may be
+// called from different goroutines.
+type Summarizer interface {
+	Update(o *Observation)
+	Summarize() []*Observation
+	// Forgets all observations seen so far.
+	Reset()
+}
+
+// Implemented by the summarizers that keep time, so that the factory
+// can hand them its clock.
+type clocked interface {
+	setClock(c Clock)
+}
+
+// A SummarizerMaker creates a Summarizer for the named series. The
+// instruments call it once for every series they summarize, e.g. a
+// Counter makes one summarizer for the count and one for the rate.
+type SummarizerMaker func(name string) Summarizer
+
+// Returns a SummarizerMaker for sliding window summarizers keeping
+// maxAge worth of observations and computing the given quantiles.
+func SlidingWindowSummarizers(maxAge time.Duration, quantiles ...float64) SummarizerMaker {
+	checkQuantiles("SlidingWindowSummarizers", quantiles)
+	return func(name string) Summarizer {
+		return NewSlidingWindowSummarizer(name, maxAge, quantiles...)
+	}
+}
+
+// Returns a SummarizerMaker for all-time cumulative summarizers.
+func CumulativeSummarizers() SummarizerMaker {
+	return func(name string) Summarizer {
+		return NewCumulativeSummarizer(name)
+	}
+}
+
+// Returns the makers for the summarizer windows given to the New*
+// constructors and the Factory. Multiple windows share storage
+// through a MultiWindowSummarizer.
+func slidingWindowSummarizerMakers(windows []time.Duration, quantiles ...float64) []SummarizerMaker {
+	switch len(windows) {
+	case 0:
+		return nil
+	case 1:
+		return []SummarizerMaker{SlidingWindowSummarizers(windows[0], quantiles...)}
+	}
+	return []SummarizerMaker{MultiWindowSummarizers(windows, quantiles...)}
+}
+
+func makeSummarizers(name string, makers []SummarizerMaker) []Summarizer {
+	summarizers := make([]Summarizer, len(makers))
+	for i, m := range makers {
+		summarizers[i] = m(name)
+	}
+	return summarizers
+}
+
 // A summarizer computes avg/sum/count/min/max. It subscribes to
 // observations and publishes the derived values. Typically it is
 // subscribed to by a HTTPPublisher which collects up to X time worth
 // of observations.
+//
+// The summarizer can also publish quantiles of the values in the
+// window, e.g. name:5M_P99 for the 99th percentile. Unlike the other
+// summaries these can't be maintained incrementally, so they are
+// computed by sorting the window values on every Summarize. To bound
+// the cost for windows holding many observations the quantiles are
+// computed from an evenly spread sample of the window, see
+// SetQuantileSampleLimit.
+//
+// Update and Summarize may be called from different goroutines, the
+// Observer updates from the goroutine calling Observe while summaries
+// are made from the sampler goroutine.
 type SlidingWindowSummarizer struct {
+	mu      sync.Mutex
 	name    string
 	suffix  string
 	window  *slidingWindow
@@ -20,6 +93,9 @@ type SlidingWindowSummarizer struct {
 	max     float64
 	avg     float64
 	timeNow func() time.Time
+
+	quantiles   []float64
+	sampleLimit int
 }
 
 func suffix(d time.Duration) string {
@@ -30,30 +106,74 @@ func suffix(d time.Duration) string {
 	} else {
 		return fmt.Sprintf("%dH", int(d/time.Hour))
 	}
-	panic("Ha ha ha")
 }
 
-func NewSlidingWindowSummarizer(name string, maxAge time.Duration) *SlidingWindowSummarizer {
+// Creates a summarizer over a window of maxAge. The quantiles are
+// given as fractions, so 0.99 gives the 99th percentile, and must be
+// in [0, 1].
+func NewSlidingWindowSummarizer(name string, maxAge time.Duration, quantiles ...float64) *SlidingWindowSummarizer {
+	checkQuantiles("NewSlidingWindowSummarizer", quantiles)
 	// TODO: Limit window size to a clean multiple of time.Minute
 	summarizer := &SlidingWindowSummarizer{
-		name:    name,
-		suffix:  suffix(maxAge),
-		window:  NewSlidingWindow(maxAge),
-		min:     math.MaxFloat64,
-		max:     -math.MaxFloat64,
-		avg:     math.NaN(),
-		timeNow: time.Now}
+		name:        name,
+		suffix:      suffix(maxAge),
+		window:      NewSlidingWindow(maxAge),
+		min:         math.MaxFloat64,
+		max:         -math.MaxFloat64,
+		avg:         math.NaN(),
+		timeNow:     time.Now,
+		quantiles:   quantiles,
+		sampleLimit: DefaultQuantileSampleLimit}
 	return summarizer
 }
 
+// Sets the maximum number of window values the quantiles are
+// computed from. When the window holds more observations than this, an
+// evenly spread sample is used, trading accuracy for speed. A limit of
+// 0 always uses every observation in the window.
+func (s *SlidingWindowSummarizer) SetQuantileSampleLimit(limit int) {
+	s.mu.Lock()
+	s.sampleLimit = limit
+	s.mu.Unlock()
+}
+
 func (s *SlidingWindowSummarizer) Summarize() []*Observation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	now := s.timeNow().UTC()
-	return []*Observation{
-		&Observation{now, s.name + ":" + s.suffix + "_MIN", s.min},
-		&Observation{now, s.name + ":" + s.suffix + "_MAX", s.max},
-		&Observation{now, s.name + ":" + s.suffix + "_SUM", s.sum},
-		&Observation{now, s.name + ":" + s.suffix + "_AVG", s.avg},
-		&Observation{now, s.name + ":" + s.suffix + "_COUNT", float64(s.count)}}
+	summaries := []*Observation{
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_MIN", Value: s.min},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_MAX", Value: s.max},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_SUM", Value: s.sum},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_AVG", Value: s.avg},
+		&Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_COUNT", Value: float64(s.count)}}
+	if len(s.quantiles) > 0 {
+		sorted := sortedSample(s.window.items[s.window.oldestAt:], s.sampleLimit)
+		for _, q := range s.quantiles {
+			summaries = append(summaries, &Observation{Timestamp: now, Name: s.name + ":" + s.suffix + "_" + quantileSuffix(q), Value: quantile(sorted, q)})
+		}
+	}
+	return summaries
+}
+
+func (s *SlidingWindowSummarizer) setClock(c Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timeNow = c.Now
+	s.window.timeNow = c.Now
+}
+
+func (s *SlidingWindowSummarizer) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timeNow := s.window.timeNow
+	s.window = NewSlidingWindow(s.window.maxAge)
+	s.window.timeNow = timeNow
+	s.sum = 0
+	s.count = 0
+	s.min = math.MaxFloat64
+	s.max = -math.MaxFloat64
+	s.avg = math.NaN()
 }
 
 func minMaxObservation(s []*Observation) (min, max float64) {
@@ -74,6 +194,8 @@ func minMaxObservation(s []*Observation) (min, max float64) {
 // internals. This is done without having to scan the entire list of
 // observations each time.
 func (s *SlidingWindowSummarizer) Update(o *Observation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
 	// TODO: If an already expired item is added we get into a weird
 	// state We should perhaps expire items when Summarize() is called